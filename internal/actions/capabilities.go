@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+
+	"github.com/go-git/go-git/v5/plumbing"
 )
 
 // Capability defines a git-remote-helper capability.
@@ -13,16 +15,60 @@ type Capability = string
 
 // Capabilities with a '*' prefix marks them as mandatory.
 const (
-	CapOption Capability = "option"
-	// CapPush   Capability = "push"
-	// CapFetch             = "fetch"
+	CapOption       Capability = "option"
+	CapPush         Capability = "push"
+	CapFetch        Capability = "fetch"
+	CapConnect      Capability = "connect"
+	CapImport       Capability = "import"
+	CapExport       Capability = "export"
+	CapRefspec      Capability = "refspec"
+	CapImportMarks  Capability = "*import-marks"
+	CapExportMarks  Capability = "*export-marks"
+	CapObjectFormat Capability = "object-format"
+	CapCheckConn    Capability = "check-connectivity"
+	CapSignedTags   Capability = "signed-tags"
 )
 
+// capabilities handles the 'capabilities' command. Git prefers connect,
+// followed by fetch and push, over import and export, so the latter are only
+// offered, alone, when configured for fast-import.
 func (action *GitOCI) capabilities(ctx context.Context) error {
-	capabilities := []Capability{CapOption}
+	capabilities := []Capability{CapOption, CapConnect, CapFetch, CapPush, CapObjectFormat, CapCheckConn}
+	if action.fastImport {
+		var err error
+		capabilities, err = action.fastImportCapabilities()
+		if err != nil {
+			return err
+		}
+	}
+
 	slog.DebugContext(ctx, "writing supported capabilities", "capabilities", fmt.Sprintf("%v", capabilities))
 	if err := action.batcher.WriteBatch(capabilities...); err != nil {
 		return fmt.Errorf("writing capabilities: %w", err)
 	}
 	return nil
 }
+
+// fastImportCapabilities returns the capabilities offered when configured for
+// fast-import. Imported references are kept in the private namespace of the
+// remote, and signed tags keep their signatures when exported.
+func (action *GitOCI) fastImportCapabilities() ([]Capability, error) {
+	capabilities := []Capability{CapOption, CapImport, CapExport, CapObjectFormat, CapSignedTags}
+	// Git uses the first matching refspec, the last matches all other references
+	for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/"} {
+		src := plumbing.ReferenceName(prefix + "*")
+		capabilities = append(capabilities, fmt.Sprintf("%s %s:%s", CapRefspec, src, action.privateRef(src)))
+	}
+
+	// marks let later exports skip the objects of earlier ones
+	if action.gitDir != "" {
+		marks, err := action.initMarks()
+		if err != nil {
+			return nil, err
+		}
+		capabilities = append(capabilities,
+			fmt.Sprintf("%s %s", CapImportMarks, marks),
+			fmt.Sprintf("%s %s", CapExportMarks, marks))
+	}
+	return capabilities, nil
+}
@@ -0,0 +1,246 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/act3-ai/gitoci/internal/git"
+	"github.com/act3-ai/gitoci/internal/model"
+	"github.com/act3-ai/gitoci/internal/progress"
+	"github.com/act3-ai/gitoci/pkg/oci"
+)
+
+// CompactOptions configure a compaction, see Compact.
+type CompactOptions struct {
+	// Geometric keeps the oldest layers that are each at least Geometric
+	// times larger than all newer layers combined, compacting the rest.
+	// Zero compacts all layers.
+	Geometric float64
+
+	// DryRun builds the compacted layer without modifying the remote.
+	DryRun bool
+}
+
+// Compact repacks the packfile layers of the remote into a single layer,
+// pointing every reference in a compacted layer at it. The compacted layer is
+// verified before the manifest is replaced, the previous manifest remains
+// available by digest. Layers pushed while compacting are kept after the
+// compacted layer. Unlike the other actions it is not driven by Git.
+func (action *GitOCI) Compact(ctx context.Context, opts CompactOptions) error {
+	action.dryRun = opts.DryRun
+
+	ref, err := parseAddress(action.addess)
+	if err != nil {
+		return err
+	}
+
+	remote, err := action.fetchRemote(ctx)
+	switch {
+	case err != nil:
+		return err
+	case !remote.Exists():
+		return fmt.Errorf("remote %s does not exist", ref.String())
+	}
+
+	layers := remote.Layers()
+	split := compactSplit(layers, opts.Geometric)
+	compacted := layers[split:]
+	if len(compacted) < 2 {
+		_, err := fmt.Fprintf(action.out, "Nothing to compact, %d layers\n", len(layers))
+		return err
+	}
+
+	tmpDir, tmp, err := git.InitTemp("git-remote-oci-compact-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	meter := action.meter("Receiving layers", len(compacted))
+	if err := action.indexLayers(ctx, remote, tmp, compacted, meter); err != nil {
+		return err
+	}
+	meter.Finish()
+
+	objs, err := git.Objects(tmp)
+	if err != nil {
+		return err
+	}
+	slog.DebugContext(ctx, "repacking layers", "layers", len(compacted), "objects", len(objs))
+
+	cfg := remote.Config()
+	meter = action.meter("Writing layers", 1)
+	layer, err := action.pushLayer(ctx, remote, packObjects(ctx, tmpDir, tmp, objs), objs, compactTips(cfg, compacted), meter)
+	if err != nil {
+		return err
+	}
+	meter.Finish()
+
+	if !action.dryRun {
+		if err := verifyLayer(ctx, remote, layer, objs); err != nil {
+			return err
+		}
+	}
+
+	// layers pushed concurrently are kept after the compacted layer
+	prev := remote.Manifest()
+	annotations := map[string]string{
+		oci.AnnotationGitRemoteOCIVersion: action.version,
+	}
+	desc, err := action.pushManifest(ctx, remote, ref, annotations, func(int) (bool, error) {
+		newer, err := newerLayers(remote, layers)
+		if err != nil {
+			return false, fmt.Errorf("updating remote %s: %w, compact again", ref.String(), err)
+		}
+		if err := rewriteLayers(remote, compacted, layer); err != nil {
+			return false, err
+		}
+		prev = remote.Manifest()
+		annotations[oci.AnnotationGitCompactedFrom] = prev.Digest.String()
+		remote.SetLayers(slices.Concat(layers[:split], []ocispec.Descriptor{layer}, newer)...)
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	before := progress.HumanBytes(float64(layersSize(compacted)))
+	after := progress.HumanBytes(float64(layer.Size))
+	if action.dryRun {
+		_, err := fmt.Fprintf(action.out, "Would compact %d layers into 1, %s -> %s\n", len(compacted), before, after)
+		return err
+	}
+	slog.InfoContext(ctx, "compacted remote", "reference", ref.String(), "digest", desc.Digest, "previous", prev.Digest)
+
+	_, err = fmt.Fprintf(action.out, "Compacted %d layers into 1, %s -> %s\nPrevious manifest: %s/%s@%s\n",
+		len(compacted), before, after, ref.Registry, ref.Repository, prev.Digest)
+	return err
+}
+
+// newerLayers returns the layers of the remote pushed after base, the layers
+// it had when an action was planned. An error is returned if the remote no
+// longer starts with base, e.g. after a concurrent compaction.
+func newerLayers(remote model.Modeler, base []ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+	layers := remote.Layers()
+	sameDigest := func(a, b ocispec.Descriptor) bool {
+		return a.Digest == b.Digest
+	}
+	if len(layers) < len(base) || !slices.EqualFunc(base, layers[:len(base)], sameDigest) {
+		return nil, errors.New("remote layers rewritten concurrently")
+	}
+	return layers[len(base):], nil
+}
+
+// compactSplit returns the index of the first layer to compact. With a
+// geometric factor, older layers are kept while each is at least factor times
+// larger than all newer layers combined, as they are likely to hold most of
+// the history.
+func compactSplit(layers []ocispec.Descriptor, factor float64) int {
+	if factor <= 0 || len(layers) == 0 {
+		return 0
+	}
+
+	split := len(layers) - 1
+	newer := layers[split].Size
+	for split > 0 && float64(layers[split-1].Size) < factor*float64(newer) {
+		split--
+		newer += layers[split].Size
+	}
+	return split
+}
+
+// compactTips returns the tips of compacted layers, falling back to the
+// references in the config for layers without tips annotations.
+func compactTips(cfg oci.ConfigGit, layers []ocispec.Descriptor) []string {
+	var tips []string
+	for _, desc := range layers {
+		if annotation, ok := desc.Annotations[oci.AnnotationGitPackTips]; ok {
+			tips = append(tips, strings.Split(annotation, ",")...)
+			continue
+		}
+		for _, refs := range cfg.References() {
+			for _, info := range refs {
+				if info.Layer == desc.Digest {
+					tips = append(tips, info.Commit.String())
+				}
+			}
+		}
+	}
+
+	slices.Sort(tips)
+	return slices.Compact(tips)
+}
+
+// rewriteLayers points the references in compacted layers at the layer that
+// replaces them.
+func rewriteLayers(remote model.Modeler, compacted []ocispec.Descriptor, layer ocispec.Descriptor) error {
+	replaced := make(map[digest.Digest]digest.Digest, len(compacted))
+	for _, desc := range compacted {
+		replaced[desc.Digest] = layer.Digest
+	}
+	return relinkRefs(remote, replaced)
+}
+
+// relinkRefs points the references in replaced layers at their replacements.
+func relinkRefs(remote model.Modeler, replaced map[digest.Digest]digest.Digest) error {
+	updates := make(map[plumbing.ReferenceName]oci.ReferenceInfo)
+	for _, refs := range remote.Config().References() {
+		for name, info := range refs {
+			if layer, ok := replaced[info.Layer]; ok {
+				info.Layer = layer
+				updates[name] = info
+			}
+		}
+	}
+
+	for name, info := range updates {
+		if err := remote.UpdateRef(name, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyLayer fetches a pushed layer, ensuring it contains all objects.
+func verifyLayer(ctx context.Context, remote model.Modeler, layer ocispec.Descriptor, objs []plumbing.Hash) error {
+	tmpDir, tmp, err := git.InitTemp("git-remote-oci-verify-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := fetchLayer(ctx, remote, tmp, layer, nil); err != nil {
+		return fmt.Errorf("verifying layer %s: %w", layer.Digest, err)
+	}
+
+	for _, h := range objs {
+		exists, err := git.HasObject(tmp, h)
+		switch {
+		case err != nil:
+			return fmt.Errorf("verifying layer %s: %w", layer.Digest, err)
+		case !exists:
+			return fmt.Errorf("verifying layer %s: object %s missing", layer.Digest, h)
+		}
+	}
+	slog.DebugContext(ctx, "verified compacted layer", "layer", layer.Digest, "objects", len(objs))
+	return nil
+}
+
+// layersSize returns the combined size of layers.
+func layersSize(layers []ocispec.Descriptor) int64 {
+	var size int64
+	for _, desc := range layers {
+		size += desc.Size
+	}
+	return size
+}
@@ -0,0 +1,238 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content/memory"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+
+	"github.com/act3-ai/gitoci/internal/cmd"
+	"github.com/act3-ai/gitoci/internal/git"
+	"github.com/act3-ai/gitoci/internal/model"
+)
+
+func Test_compactSplit(t *testing.T) {
+	layers := func(sizes ...int64) []ocispec.Descriptor {
+		descs := make([]ocispec.Descriptor, 0, len(sizes))
+		for _, size := range sizes {
+			descs = append(descs, ocispec.Descriptor{Size: size})
+		}
+		return descs
+	}
+
+	tests := []struct {
+		name   string
+		layers []ocispec.Descriptor
+		factor float64
+		want   int
+	}{
+		{
+			name:   "All",
+			layers: layers(1000, 10, 10),
+			want:   0,
+		},
+		{
+			name:   "Geometric",
+			layers: layers(1000, 10, 10, 10),
+			factor: 2,
+			want:   1,
+		},
+		{
+			name:   "Geometric Progression",
+			layers: layers(1000, 100, 10, 5),
+			factor: 2,
+			want:   3,
+		},
+		{
+			name:   "Geometric Newest Large",
+			layers: layers(1000, 10, 10, 500),
+			factor: 2,
+			want:   0,
+		},
+		{
+			name:   "Empty",
+			layers: nil,
+			factor: 2,
+			want:   0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, compactSplit(tt.layers, tt.factor))
+		})
+	}
+}
+
+// newRemoteAction returns an action for the remote tagged v1 in store, pushing
+// from local.
+func newRemoteAction(t *testing.T, store oras.GraphTarget, local *filesystem.Storage) (*GitOCI, *bytes.Buffer) {
+	t.Helper()
+
+	remote := model.NewModeler(store)
+	if _, err := remote.Fetch(context.Background(), "v1"); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+
+	var out bytes.Buffer
+	action := &GitOCI{
+		batcher: cmd.NewBatcher(strings.NewReader(""), io.Discard),
+		out:     &out,
+		name:    "origin",
+		addess:  "registry.example.com/repo:v1",
+		local:   local,
+		remote:  remote,
+	}
+	return action, &out
+}
+
+// pushCommit points a local reference at commit and pushes it, adding a layer
+// to the remote. A zero commit deletes the remote reference.
+func pushCommit(t *testing.T, action *GitOCI, name plumbing.ReferenceName, commit plumbing.Hash) {
+	t.Helper()
+
+	refspec := "+:" + name.String()
+	if !commit.IsZero() {
+		if err := action.local.SetReference(plumbing.NewHashReference(name, commit)); err != nil {
+			t.Fatalf("SetReference() error = %v", err)
+		}
+		refspec = "+" + name.String() + ":" + name.String()
+	}
+
+	updates := parseRefspecs(t, refspec)
+	if err := action.pushUpdates(context.Background(), action.remote, action.local, updates); err != nil {
+		t.Fatalf("pushUpdates() error = %v", err)
+	}
+	if updates[0].err != nil {
+		t.Fatalf("pushing %s: %v", name, updates[0].err)
+	}
+}
+
+// racingModeler modifies the remote concurrently, by running race before
+// the first push of the manifest.
+type racingModeler struct {
+	model.Modeler
+	race func()
+}
+
+// Push implements model.Modeler.
+func (m *racingModeler) Push(ctx context.Context, ref string, annotations map[string]string) (ocispec.Descriptor, error) {
+	if race := m.race; race != nil {
+		m.race = nil
+		race()
+	}
+	return m.Modeler.Push(ctx, ref, annotations) //nolint:wrapcheck
+}
+
+// layerDigests returns the digests of the layers of a remote.
+func layerDigests(remote model.Modeler) []digest.Digest {
+	digests := make([]digest.Digest, 0, len(remote.Layers()))
+	for _, desc := range remote.Layers() {
+		digests = append(digests, desc.Digest)
+	}
+	return digests
+}
+
+func TestGitOCI_Compact(t *testing.T) {
+	store := memory.New()
+	local := newTestStorage()
+	action, _ := newRemoteAction(t, store, local)
+
+	c1 := testCommit(t, local, "c1")
+	c2 := testCommit(t, local, "c2", c1)
+	c3 := testCommit(t, local, "c3", c2)
+	c4 := testCommit(t, local, "c4", c3)
+	for _, commit := range []plumbing.Hash{c1, c2, c3} {
+		pushCommit(t, action, "refs/heads/main", commit)
+	}
+
+	tests := []struct {
+		name    string
+		race    func(t *testing.T)
+		wantErr bool
+	}{
+		{
+			name: "Unmodified",
+		},
+		{
+			name: "Concurrent Push",
+			race: func(t *testing.T) {
+				other, _ := newRemoteAction(t, store, local)
+				pushCommit(t, other, "refs/heads/topic", c4)
+			},
+		},
+		{
+			name: "Concurrent Compaction",
+			race: func(t *testing.T) {
+				other, _ := newRemoteAction(t, store, local)
+				if err := other.Compact(context.Background(), CompactOptions{}); err != nil {
+					t.Fatalf("Compact() error = %v", err)
+				}
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// each compaction starts from the same three layers
+			prev := action.remote.Manifest()
+			t.Cleanup(func() {
+				if err := store.Tag(context.Background(), prev, "v1"); err != nil {
+					t.Fatalf("restoring manifest: %v", err)
+				}
+			})
+
+			compact, out := newRemoteAction(t, store, local)
+			remote := &racingModeler{Modeler: compact.remote}
+			if tt.race != nil {
+				remote.race = func() { tt.race(t) }
+			}
+			compact.remote = remote
+
+			err := compact.Compact(context.Background(), CompactOptions{})
+			if tt.wantErr {
+				assert.ErrorContains(t, err, "compact again")
+				return
+			}
+			if err != nil {
+				t.Fatalf("Compact() error = %v", err)
+			}
+			assert.Contains(t, out.String(), "Compacted 3 layers into 1")
+
+			if _, err := remote.Fetch(context.Background(), "v1"); err != nil {
+				t.Fatalf("Fetch() error = %v", err)
+			}
+			layers := layerDigests(remote)
+			cfg := remote.Config()
+			assert.Equal(t, layers[0], cfg.Heads["refs/heads/main"].Layer)
+			if tt.race == nil {
+				assert.Len(t, layers, 1)
+				return
+			}
+
+			// the concurrently pushed layer is kept after the compacted layer
+			assert.Len(t, layers, 2)
+			assert.Equal(t, layers[1], cfg.Heads["refs/heads/topic"].Layer)
+			fetched := newTestStorage()
+			if err := action.indexLayers(context.Background(), remote, fetched, remote.Layers(), nil); err != nil {
+				t.Fatalf("indexLayers() error = %v", err)
+			}
+			for _, commit := range []plumbing.Hash{c1, c2, c3, c4} {
+				exists, err := git.HasObject(fetched, commit)
+				if err != nil {
+					t.Fatalf("HasObject() error = %v", err)
+				}
+				assert.True(t, exists, "commit %s", commit)
+			}
+		})
+	}
+}
@@ -0,0 +1,323 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+
+	"github.com/act3-ai/gitoci/internal/cmd"
+	"github.com/act3-ai/gitoci/internal/git"
+	"github.com/act3-ai/gitoci/internal/model"
+	"github.com/act3-ai/gitoci/pkg/oci"
+)
+
+// capNoThin asks Git not to send thin packs, whose deltas refer to objects
+// outside of the packfile. Received packfiles are pushed as layers, which must
+// be self-contained.
+//
+// https://git-scm.com/docs/protocol-capabilities#_no_thin
+const capNoThin capability.Capability = "no-thin"
+
+// connect handles the 'connect' command, serving git-receive-pack of Git's
+// pack protocol, version 0, from the OCI remote. It returns false if Git was
+// told to fall back to the fetch and push capabilities, true if the connection
+// was served.
+//
+// git-upload-pack always falls back to fetch, which indexes packfile layers
+// directly in the local repository. A layer is a packfile of its own, so
+// serving them over the pack protocol would mean repacking them, from the same
+// local repository Git reads.
+//
+// https://git-scm.com/docs/gitremote-helpers#Documentation/gitremote-helpers.txt-connectservice
+// https://git-scm.com/docs/pack-protocol
+func (action *GitOCI) connect(ctx context.Context, c cmd.Git) (bool, error) {
+	slog.DebugContext(ctx, "handling connect", "service", c.SubCmd)
+
+	if action.connectFallback(c.SubCmd) {
+		slog.DebugContext(ctx, "falling back to fetch and push", "service", c.SubCmd)
+		if err := action.batcher.Write("fallback"); err != nil {
+			return false, fmt.Errorf("writing connect response: %w", err)
+		}
+		if err := action.batcher.Flush(false); err != nil {
+			return false, fmt.Errorf("writing connect response: %w", err)
+		}
+		return false, nil
+	}
+
+	remote, err := action.fetchRemote(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	// a blank line indicates the connection is established
+	if err := action.batcher.WriteBatch(); err != nil {
+		return false, fmt.Errorf("writing connect response: %w", err)
+	}
+
+	return true, action.receivePack(ctx, remote)
+}
+
+// connectFallback returns true if Git should fall back to the fetch and push
+// capabilities for a service, only git-receive-pack is served.
+func (action *GitOCI) connectFallback(service cmd.Type) bool {
+	return service != cmd.ReceivePack
+}
+
+// receivePack serves git-receive-pack. Reference updates are validated and
+// applied as they are for push commands, with the old object ID of each
+// command used as a lease on the remote reference. The packfile sent by Git
+// is pushed as the layer of the updates, see receiveLayer.
+func (action *GitOCI) receivePack(ctx context.Context, remote model.Modeler) error {
+	adv := action.advertisement(remote.Config())
+	for _, c := range []capability.Capability{capability.ReportStatus, capability.Atomic, capability.DeleteRefs, capability.OFSDelta, capNoThin} {
+		if err := adv.Capabilities.Add(c); err != nil {
+			return fmt.Errorf("advertising capability %s: %w", c, err)
+		}
+	}
+	nonce, err := pushCertNonce()
+	if err != nil {
+		return err
+	}
+	if err := adv.Capabilities.Set(capability.PushCert, nonce); err != nil {
+		return fmt.Errorf("advertising capability %s: %w", capability.PushCert, err)
+	}
+	if err := adv.Encode(action.out); err != nil {
+		return fmt.Errorf("advertising references: %w", err)
+	}
+
+	scanner := pktline.NewScanner(action.in)
+	updates, caps, err := action.readUpdates(scanner)
+	switch {
+	case err != nil:
+		return err
+	case len(updates) == 0:
+		slog.DebugContext(ctx, "no reference updates requested")
+		return nil
+	}
+	slog.DebugContext(ctx, "received reference updates", "count", len(updates), "capabilities", caps)
+	if strings.Contains(caps, capability.Atomic.String()) {
+		action.atomic = true
+	}
+
+	local, err := action.openLocal()
+	if err != nil {
+		return err
+	}
+
+	for _, u := range updates {
+		u.err = resolveUpdate(local, u)
+	}
+	// a certificate for another session could be replayed
+	if action.pushCert != nil && certNonce(action.pushCert) != nonce {
+		for _, u := range updates {
+			u.err = errors.New("push certificate nonce mismatch")
+		}
+	}
+	action.validateUpdates(local, remote.Config(), updates)
+
+	// a packfile follows unless all commands are deletions
+	var layer ocispec.Descriptor
+	switch {
+	case allDeletions(updates):
+	case len(acceptedCommits(updates)) == 0:
+		if err := git.SkipPack(action.in); err != nil {
+			return err
+		}
+	default:
+		layer, err = action.receiveLayer(ctx, remote, local, acceptedCommits(updates))
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := action.publishUpdates(ctx, remote, local, updates, layer); err != nil {
+		return err
+	}
+	if err := action.updatePrivateRefs(ctx, local, remote); err != nil {
+		return err
+	}
+	if err := action.storePushCert(ctx, remote, updates); err != nil {
+		return err
+	}
+
+	if !strings.Contains(caps, capability.ReportStatus.String()) {
+		return nil
+	}
+
+	status := packp.NewReportStatus()
+	status.UnpackStatus = "ok"
+	for _, u := range updates {
+		cs := &packp.CommandStatus{ReferenceName: u.dst, Status: "ok"}
+		if u.err != nil {
+			slog.InfoContext(ctx, "rejected reference update", "reference", u.dst, "reason", u.err.Error())
+			cs.Status = u.err.Error()
+		}
+		status.CommandStatuses = append(status.CommandStatuses, cs)
+	}
+	if err := status.Encode(action.out); err != nil {
+		return fmt.Errorf("writing report status: %w", err)
+	}
+
+	return nil
+}
+
+// receiveLayer pushes the packfile sent by Git to the remote as a layer,
+// while it is being received, returning an empty descriptor if it has no
+// objects. The packfile is indexed into a temporary repository to verify it
+// holds every object the remote needs for want.
+func (action *GitOCI) receiveLayer(ctx context.Context, remote model.Modeler, local *filesystem.Storage, want []plumbing.Hash) (ocispec.Descriptor, error) {
+	// the object count follows the signature and version
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(action.in, header); err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("reading packfile header: %w", err)
+	}
+	r := io.MultiReader(bytes.NewReader(header), action.in)
+	if binary.BigEndian.Uint32(header[8:]) == 0 {
+		slog.DebugContext(ctx, "remote has all objects, skipping packfile layer")
+		return ocispec.Descriptor{}, git.SkipPack(r)
+	}
+
+	tmpDir, tmp, err := git.InitTemp("git-remote-oci-receive-*")
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// the packfile can only be read once, so its upload can't be resumed
+	var objs []plumbing.Hash
+	pack := func(w io.Writer) error {
+		var err error
+		objs, err = git.IndexPackTee(tmp, r, w)
+		return err
+	}
+	meter := action.meter("Writing layers", 1)
+	layer, err := action.pushLayer(ctx, remote, pack, nil, hashStrings(want), meter)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	meter.Finish()
+
+	// the remote has the objects reachable from its references
+	required, err := git.ListObjects(local, want, remoteCommits(remote.Config()))
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	received := make(map[plumbing.Hash]struct{}, len(objs))
+	for _, h := range objs {
+		received[h] = struct{}{}
+	}
+	for _, h := range required {
+		if _, ok := received[h]; !ok {
+			return ocispec.Descriptor{}, fmt.Errorf("verifying packfile layer %s: object %s missing", layer.Digest, h)
+		}
+	}
+	slog.DebugContext(ctx, "pushed packfile layer", "layer", layer.Digest, "size", layer.Size, "objects", len(objs))
+
+	return layer, nil
+}
+
+// readUpdates reads the reference update commands sent by the client, and the
+// capabilities it requested, up to a flush-pkt. The old object ID of each
+// command is recorded as the expected value of the remote reference. Signed
+// pushes send their commands within a push certificate, see pushCert.
+func (action *GitOCI) readUpdates(scanner *pktline.Scanner) ([]*refUpdate, string, error) {
+	var updates []*refUpdate
+	var caps string
+	for scanner.Scan() {
+		line := strings.TrimSuffix(string(scanner.Bytes()), "\n")
+		if line == "" {
+			return updates, caps, nil
+		}
+
+		// capabilities are sent with the first command
+		line, c, _ := strings.Cut(line, "\x00")
+		if len(updates) == 0 {
+			caps = c
+		}
+
+		commands := []string{line}
+		if line == "push-cert" {
+			cert, certCommands, err := readPushCert(scanner)
+			if err != nil {
+				return nil, "", err
+			}
+			action.pushCert = cert
+			commands = certCommands
+		}
+
+		for _, command := range commands {
+			u, err := action.parseCommand(command)
+			if err != nil {
+				return nil, "", err
+			}
+			updates = append(updates, u)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, "", fmt.Errorf("reading commands: %w", err)
+	}
+	// Git hung up, e.g. nothing to push
+	return nil, "", nil
+}
+
+// parseCommand parses a reference update command, <old> <new> <name>.
+func (action *GitOCI) parseCommand(line string) (*refUpdate, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 || !plumbing.IsHash(fields[0]) || !plumbing.IsHash(fields[1]) {
+		return nil, fmt.Errorf("unexpected line from Git, expected command: %s", line)
+	}
+	old, name := plumbing.NewHash(fields[0]), plumbing.ReferenceName(fields[2])
+
+	if action.cas == nil {
+		action.cas = make(map[plumbing.ReferenceName]plumbing.Hash)
+	}
+	action.cas[name] = old
+
+	// Git has already evaluated fast-forwards against the advertisement,
+	// the lease ensures the remote hasn't changed since. Whether a deletion
+	// was forced isn't sent, so the branch of the remote HEAD stays protected.
+	u := &refUpdate{
+		dst:    name,
+		commit: plumbing.NewHash(fields[1]),
+	}
+	u.force = !u.deletes()
+	return u, nil
+}
+
+// allDeletions returns true if all reference updates delete a reference.
+func allDeletions(updates []*refUpdate) bool {
+	for _, u := range updates {
+		if !u.deletes() {
+			return false
+		}
+	}
+	return true
+}
+
+// advertisement initializes the reference advertisement of the remote.
+func (action *GitOCI) advertisement(cfg oci.ConfigGit) *packp.AdvRefs {
+	adv := packp.NewAdvRefs()
+	_ = adv.Capabilities.Set(capability.Agent, "git-remote-oci/"+action.version)
+	_ = adv.Capabilities.Set(capability.ObjectFormat, string(cfg.ObjectFormat))
+
+	for _, refs := range cfg.References() {
+		for name, info := range refs {
+			adv.References[name.String()] = info.Commit
+		}
+	}
+	return adv
+}
@@ -0,0 +1,281 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"oras.land/oras-go/v2/content/memory"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+
+	"github.com/act3-ai/gitoci/internal/git"
+	"github.com/act3-ai/gitoci/internal/model"
+	"github.com/act3-ai/gitoci/pkg/oci"
+)
+
+func TestGitOCI_readUpdates(t *testing.T) {
+	// object IDs are as long as the object format of the build requires
+	var (
+		oldHash = plumbing.ComputeHash(plumbing.BlobObject, []byte("old")).String()
+		newHash = plumbing.ComputeHash(plumbing.BlobObject, []byte("new")).String()
+	)
+
+	tests := []struct {
+		name     string
+		lines    []string
+		want     []*refUpdate
+		wantCaps string
+		wantCAS  map[plumbing.ReferenceName]plumbing.Hash
+		wantCert string
+		wantErr  bool
+	}{
+		{
+			name: "Update With Capabilities",
+			lines: []string{
+				oldHash + " " + newHash + " refs/heads/main\x00report-status atomic\n",
+				plumbing.ZeroHash.String() + " " + newHash + " refs/tags/v1\n",
+			},
+			want: []*refUpdate{
+				{force: true, dst: "refs/heads/main", commit: plumbing.NewHash(newHash)},
+				{force: true, dst: "refs/tags/v1", commit: plumbing.NewHash(newHash)},
+			},
+			wantCaps: "report-status atomic",
+			wantCAS: map[plumbing.ReferenceName]plumbing.Hash{
+				"refs/heads/main": plumbing.NewHash(oldHash),
+				"refs/tags/v1":    plumbing.ZeroHash,
+			},
+		},
+		{
+			name: "Deletion",
+			lines: []string{
+				oldHash + " " + plumbing.ZeroHash.String() + " refs/heads/topic\x00report-status delete-refs\n",
+			},
+			want: []*refUpdate{
+				{dst: "refs/heads/topic"},
+			},
+			wantCaps: "report-status delete-refs",
+			wantCAS: map[plumbing.ReferenceName]plumbing.Hash{
+				"refs/heads/topic": plumbing.NewHash(oldHash),
+			},
+		},
+		{
+			name: "Push Certificate",
+			lines: []string{
+				"push-cert\x00report-status\n",
+				"certificate version 0.1\n",
+				"pusher a@b 1749988800 +0000\n",
+				"nonce 1749988800-abc\n",
+				"\n",
+				oldHash + " " + newHash + " refs/heads/main\n",
+				"-----BEGIN SSH SIGNATURE-----\n",
+				"U1NIU0lH\n",
+				"-----END SSH SIGNATURE-----\n",
+				"push-cert-end\n",
+			},
+			want: []*refUpdate{
+				{force: true, dst: "refs/heads/main", commit: plumbing.NewHash(newHash)},
+			},
+			wantCaps: "report-status",
+			wantCAS: map[plumbing.ReferenceName]plumbing.Hash{
+				"refs/heads/main": plumbing.NewHash(oldHash),
+			},
+			wantCert: "certificate version 0.1\npusher a@b 1749988800 +0000\nnonce 1749988800-abc\n\n" +
+				oldHash + " " + newHash + " refs/heads/main\n" +
+				"-----BEGIN SSH SIGNATURE-----\nU1NIU0lH\n-----END SSH SIGNATURE-----\n",
+		},
+		{
+			name: "Push Certificate Unterminated",
+			lines: []string{
+				"push-cert\x00report-status\n",
+				"certificate version 0.1\n",
+			},
+			wantErr: true,
+		},
+		{
+			name:  "No Commands",
+			lines: []string{},
+		},
+		{
+			name: "Invalid Command",
+			lines: []string{
+				"refs/heads/main\n",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := pktline.NewEncoder(&buf)
+			if err := enc.EncodeString(tt.lines...); err != nil {
+				t.Fatalf("encoding commands: %v", err)
+			}
+			if err := enc.Flush(); err != nil {
+				t.Fatalf("encoding flush: %v", err)
+			}
+
+			action := &GitOCI{}
+			got, caps, err := action.readUpdates(pktline.NewScanner(&buf))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("readUpdates() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantCaps, caps)
+			assert.Equal(t, tt.wantCAS, action.cas)
+			assert.Equal(t, tt.wantCert, string(action.pushCert))
+			if tt.wantCert != "" {
+				assert.Equal(t, "1749988800-abc", certNonce(action.pushCert))
+			}
+		})
+	}
+}
+
+// newTestAction returns an action connected to an empty in-memory remote and
+// local repository, reading the client's side of the connection from in.
+func newTestAction(t *testing.T, in io.Reader) (*GitOCI, *bytes.Buffer) {
+	t.Helper()
+
+	remote := model.NewModeler(memory.New())
+	if _, err := remote.Fetch(context.Background(), "v1"); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+
+	var out bytes.Buffer
+	action := &GitOCI{
+		in:     in,
+		out:    &out,
+		name:   "origin",
+		addess: "registry.example.com/repo:v1",
+		local:  newTestStorage(),
+		remote: remote,
+	}
+	return action, &out
+}
+
+// encodeLines encodes pkt-lines, where an empty line is a flush-pkt.
+func encodeLines(t *testing.T, w io.Writer, lines ...string) {
+	t.Helper()
+
+	enc := pktline.NewEncoder(w)
+	for _, line := range lines {
+		var err error
+		if line == "" {
+			err = enc.Flush()
+		} else {
+			err = enc.EncodeString(line)
+		}
+		if err != nil {
+			t.Fatalf("encoding %q: %v", line, err)
+		}
+	}
+}
+
+// readAdvertisement reads a reference advertisement up to its flush-pkt,
+// returning the advertised references, including peeled tags, and the
+// capabilities. packp.AdvRefs can only decode SHA-1 object IDs.
+func readAdvertisement(t *testing.T, r io.Reader) (map[string]plumbing.Hash, string) {
+	t.Helper()
+
+	refs := make(map[string]plumbing.Hash)
+	var caps string
+	scanner := pktline.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(string(scanner.Bytes()), "\n")
+		if line == "" {
+			return refs, caps
+		}
+		line, c, ok := strings.Cut(line, "\x00")
+		if ok {
+			caps = c
+		}
+		h, name, ok := strings.Cut(line, " ")
+		if !ok || !plumbing.IsHash(h) {
+			t.Fatalf("unexpected advertisement line: %s", line)
+		}
+		refs[name] = plumbing.NewHash(h)
+	}
+	t.Fatalf("reading advertisement: %v", scanner.Err())
+	return nil, ""
+}
+
+func TestGitOCI_receivePack(t *testing.T) {
+	ctx := context.Background()
+	var in bytes.Buffer
+	action, out := newTestAction(t, &in)
+
+	base := testCommit(t, action.local, "base")
+	next := testCommit(t, action.local, "next", base)
+	stale := testCommit(t, newTestStorage(), "stale")
+	if err := action.remote.UpdateRef("refs/heads/main", oci.ReferenceInfo{Commit: base}); err != nil {
+		t.Fatalf("UpdateRef() error = %v", err)
+	}
+
+	// the lease on the topic branch no longer holds, it doesn't exist
+	encodeLines(t, &in,
+		base.String()+" "+next.String()+" refs/heads/main\x00report-status\n",
+		stale.String()+" "+next.String()+" refs/heads/topic\n",
+		"",
+	)
+	// the tree of next is the tree of base, which the remote has
+	if err := git.EncodePack(&in, action.local, []plumbing.Hash{next}); err != nil {
+		t.Fatalf("encoding packfile: %v", err)
+	}
+
+	if err := action.receivePack(ctx, action.remote); err != nil {
+		t.Fatalf("receivePack() error = %v", err)
+	}
+
+	refs, caps := readAdvertisement(t, out)
+	assert.Equal(t, map[string]plumbing.Hash{"refs/heads/main": base}, refs)
+	assert.Contains(t, strings.Fields(caps), capability.ReportStatus.String())
+	assert.Contains(t, strings.Fields(caps), capability.Atomic.String())
+	assert.Contains(t, strings.Fields(caps), capNoThin.String())
+
+	status := packp.NewReportStatus()
+	if err := status.Decode(out); err != nil {
+		t.Fatalf("decoding report status: %v", err)
+	}
+	assert.Equal(t, "ok", status.UnpackStatus)
+	assert.Equal(t, []*packp.CommandStatus{
+		{ReferenceName: "refs/heads/main", Status: "ok"},
+		{ReferenceName: "refs/heads/topic", Status: errStaleInfo.Error()},
+	}, status.CommandStatuses)
+
+	// only the accepted update reached the remote
+	cfg := action.remote.Config()
+	assert.Equal(t, next, cfg.Heads["refs/heads/main"].Commit)
+	assert.NotContains(t, cfg.Heads, plumbing.ReferenceName("refs/heads/topic"))
+	assert.NotEmpty(t, action.remote.Manifest().Digest, "remote was not pushed")
+	assert.Len(t, action.remote.Layers(), 1, "packfile was not pushed as a layer")
+}
+
+func TestGitOCI_receivePack_missingObjects(t *testing.T) {
+	ctx := context.Background()
+	var in bytes.Buffer
+	action, out := newTestAction(t, &in)
+
+	// the remote has no objects, the packfile lacks the tree of the commit
+	main := testCommit(t, action.local, "main")
+	encodeLines(t, &in,
+		plumbing.ZeroHash.String()+" "+main.String()+" refs/heads/main\x00report-status\n",
+		"",
+	)
+	if err := git.EncodePack(&in, action.local, []plumbing.Hash{main}); err != nil {
+		t.Fatalf("encoding packfile: %v", err)
+	}
+
+	if err := action.receivePack(ctx, action.remote); err == nil {
+		t.Fatalf("receivePack() expected error for missing objects")
+	}
+	readAdvertisement(t, out)
+	assert.Zero(t, out.Len(), "report status written")
+	assert.Empty(t, action.remote.Config().Heads, "remote updated")
+}
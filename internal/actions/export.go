@@ -0,0 +1,54 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/act3-ai/gitoci/internal/git"
+)
+
+// export handles the 'export' command, reading a fast-export stream into the
+// local repository and pushing the references it updates.
+//
+// Marks from earlier exports, kept in the marks file by Git, resolve objects
+// the stream refers to but omits.
+//
+// https://git-scm.com/docs/gitremote-helpers#Documentation/gitremote-helpers.txt-export
+func (action *GitOCI) export(ctx context.Context) error {
+	slog.DebugContext(ctx, "handling export")
+
+	remote, err := action.fetchRemote(ctx)
+	if err != nil {
+		return err
+	}
+
+	local, err := action.openLocal()
+	if err != nil {
+		return err
+	}
+
+	marks, err := git.ReadMarks(filepath.Join(action.privateDir(), marksFile))
+	if err != nil {
+		return err
+	}
+
+	refs, err := git.ImportStream(action.in, local, marks)
+	if err != nil {
+		return fmt.Errorf("reading fast-export stream: %w", err)
+	}
+	slog.DebugContext(ctx, "read fast-export stream", "references", len(refs))
+
+	updates := make([]*refUpdate, 0, len(refs))
+	for _, ref := range refs {
+		// a zero hash deletes the reference, see resolveUpdate
+		updates = append(updates, &refUpdate{
+			force:  action.force,
+			dst:    ref.Name(),
+			commit: ref.Hash(),
+		})
+	}
+
+	return action.pushUpdates(ctx, remote, local, updates)
+}
@@ -0,0 +1,325 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/sync/errgroup"
+	"oras.land/oras-go/v2/content"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+
+	"github.com/act3-ai/gitoci/internal/cmd"
+	"github.com/act3-ai/gitoci/internal/git"
+	"github.com/act3-ai/gitoci/internal/model"
+	"github.com/act3-ai/gitoci/internal/progress"
+	"github.com/act3-ai/gitoci/pkg/oci"
+)
+
+// fetch handles a batch of 'fetch' commands.
+//
+// https://git-scm.com/docs/gitremote-helpers#Documentation/gitremote-helpers.txt-fetchsha1name
+func (action *GitOCI) fetch(ctx context.Context, cmds []cmd.Git) error {
+	slog.DebugContext(ctx, "handling fetch batch", "count", len(cmds))
+
+	remote, err := action.fetchRemote(ctx)
+	if err != nil {
+		return err
+	}
+
+	local, err := action.openLocal()
+	if err != nil {
+		return err
+	}
+
+	var lines []string
+	if action.shallow() {
+		if err := action.fetchShallow(ctx, remote, local, cmds); err != nil {
+			return err
+		}
+	} else {
+		want := make([]*plumbing.Reference, 0, len(cmds))
+		for _, c := range cmds {
+			want = append(want, plumbing.NewHashReference(plumbing.ReferenceName(c.Data[1]), plumbing.NewHash(c.Data[0])))
+		}
+
+		if err := action.fetchRefs(ctx, remote, local, want); err != nil {
+			return err
+		}
+
+		if action.checkConnectivity {
+			connected, err := selfContained(ctx, remote, local, want)
+			if err != nil {
+				return err
+			}
+			// otherwise Git checks connectivity itself
+			if connected {
+				lines = append(lines, "connectivity-ok")
+			}
+		}
+	}
+
+	if err := action.updatePrivateRefs(ctx, local, remote); err != nil {
+		return err
+	}
+
+	// a blank line indicates all fetch commands are complete
+	if err := action.batcher.WriteBatch(lines...); err != nil {
+		return fmt.Errorf("writing fetch response: %w", err)
+	}
+
+	return nil
+}
+
+// fetchRefs indexes the packfile layers needed by the wanted remote references
+// in the local repository.
+func (action *GitOCI) fetchRefs(ctx context.Context, remote model.Modeler, local *filesystem.Storage, want []*plumbing.Reference) error {
+	layers, err := fetchLayers(ctx, remote, local, want)
+	if err != nil {
+		return err
+	}
+
+	meter := action.meter("Receiving layers", len(layers))
+	if err := action.indexLayers(ctx, remote, local, layers, meter); err != nil {
+		return err
+	}
+	meter.Finish()
+
+	return nil
+}
+
+// fetchLayers resolves the packfile layers needed to fetch the wanted remote
+// references, in the order they were pushed. Layers whose objects already
+// exist in the local repository are excluded.
+func fetchLayers(ctx context.Context, remote model.Modeler, local *filesystem.Storage, want []*plumbing.Reference) ([]ocispec.Descriptor, error) {
+	cfg := remote.Config()
+	layers := remote.Layers()
+
+	// packfile layers are incremental, each depending on the layers before
+	// it, so we need everything up to the newest layer containing a wanted commit
+	newest := -1
+	for _, ref := range want {
+		commit, name := ref.Hash(), ref.Name()
+
+		exists, err := git.HasObject(local, commit)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			slog.DebugContext(ctx, "commit already exists locally", "reference", name, "commit", commit.String())
+			continue
+		}
+
+		idx, err := layerIndex(cfg, layers, name, commit)
+		if err != nil {
+			return nil, err
+		}
+		newest = max(newest, idx)
+	}
+
+	// layers are indexed in full, so we only need those we haven't seen
+	needed := make([]ocispec.Descriptor, 0, newest+1)
+	var missing bool
+	for _, desc := range layers[:newest+1] {
+		if !layerIdentified(cfg, desc) {
+			// objects only reachable through other layers, fetched along with them
+			needed = append(needed, desc)
+			continue
+		}
+
+		exists, err := layerExists(local, cfg, desc)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			slog.DebugContext(ctx, "layer already exists locally", "layer", desc.Digest)
+			continue
+		}
+		needed = append(needed, desc)
+		missing = true
+	}
+
+	if !missing {
+		return nil, nil
+	}
+	return needed, nil
+}
+
+// selfContained returns true if the wanted remote references are known to be
+// connected in the local repository, proven by the packfile layers rather than
+// walking history. Layers are incremental, each packing the objects reachable
+// from its tips that are not reachable from the references of earlier layers,
+// so the objects of a reference are connected once every layer up to and
+// including its own is indexed.
+func selfContained(ctx context.Context, remote model.Modeler, local *filesystem.Storage, want []*plumbing.Reference) (bool, error) {
+	// a shallow repository is missing history by design
+	shallow, err := local.Shallow()
+	if err != nil {
+		return false, fmt.Errorf("reading shallow commits: %w", err)
+	}
+	if len(shallow) > 0 {
+		slog.DebugContext(ctx, "local repository is shallow, unable to prove connectivity")
+		return false, nil
+	}
+
+	cfg := remote.Config()
+	layers := remote.Layers()
+
+	newest := -1
+	for _, ref := range want {
+		exists, err := git.HasObject(local, ref.Hash())
+		if err != nil {
+			return false, err
+		}
+		if !exists {
+			slog.DebugContext(ctx, "wanted object missing", "reference", ref.Name(), "object", ref.Hash().String())
+			return false, nil
+		}
+
+		idx, err := layerIndex(cfg, layers, ref.Name(), ref.Hash())
+		if err != nil {
+			slog.DebugContext(ctx, "unable to resolve layer of reference", "reference", ref.Name(), "error", err.Error())
+			return false, nil
+		}
+		newest = max(newest, idx)
+	}
+
+	for _, desc := range layers[:newest+1] {
+		exists, err := layerExists(local, cfg, desc)
+		if err != nil {
+			return false, err
+		}
+		if !exists {
+			slog.DebugContext(ctx, "layer missing from local repository", "layer", desc.Digest)
+			return false, nil
+		}
+	}
+
+	slog.DebugContext(ctx, "fetched references are connected", "layers", newest+1)
+	return true, nil
+}
+
+// layerIndex returns the index of the packfile layer containing the commit of
+// a remote reference.
+func layerIndex(cfg oci.ConfigGit, layers []ocispec.Descriptor, name plumbing.ReferenceName, commit plumbing.Hash) (int, error) {
+	info, ok := resolveRef(cfg, name, commit)
+	if !ok {
+		return -1, fmt.Errorf("reference %s with commit %s not found in remote", name, commit)
+	}
+
+	idx := slices.IndexFunc(layers, func(desc ocispec.Descriptor) bool {
+		return desc.Digest == info.Layer
+	})
+	if idx < 0 {
+		return -1, fmt.Errorf("layer %s for reference %s not found in remote manifest", info.Layer, name)
+	}
+	return idx, nil
+}
+
+// indexLayers fetches packfile layers concurrently, indexing each in st as it
+// is received. Layers are self-contained packfiles, so the order they are
+// indexed in doesn't matter.
+func (action *GitOCI) indexLayers(ctx context.Context, remote model.Modeler, st *filesystem.Storage, layers []ocispec.Descriptor, meter *progress.Meter) error {
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(action.transferLimit())
+	for _, desc := range layers {
+		g.Go(func() error {
+			return fetchLayer(ctx, remote, st, desc, meter)
+		})
+	}
+	return g.Wait() //nolint:wrapcheck
+}
+
+// fetchLayer fetches a packfile layer, indexing it in the local repository
+// while verifying its digest. Transfer progress is reported to meter.
+func fetchLayer(ctx context.Context, remote model.Modeler, local *filesystem.Storage, desc ocispec.Descriptor, meter *progress.Meter) error {
+	slog.DebugContext(ctx, "fetching packfile layer", "layer", desc.Digest, "size", desc.Size)
+
+	rc, err := remote.FetchLayer(ctx, desc)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	vr := content.NewVerifyReader(rc, desc)
+	if err := git.IndexPack(local, meter.Reader(vr)); err != nil {
+		return fmt.Errorf("indexing layer %s: %w", desc.Digest, err)
+	}
+	if err := vr.Verify(); err != nil {
+		return fmt.Errorf("verifying layer %s: %w", desc.Digest, err)
+	}
+	meter.LayerDone()
+
+	return nil
+}
+
+// resolveRef resolves the reference information of a remote reference,
+// falling back to a search by commit for names not stored in the config,
+// e.g. HEAD.
+func resolveRef(cfg oci.ConfigGit, name plumbing.ReferenceName, commit plumbing.Hash) (oci.ReferenceInfo, bool) {
+	if info, ok := cfg.Reference(name); ok && info.Commit == commit {
+		return info, true
+	}
+
+	for _, refs := range cfg.References() {
+		for _, info := range refs {
+			if info.Commit == commit {
+				return info, true
+			}
+		}
+	}
+	return oci.ReferenceInfo{}, false
+}
+
+// layerExists returns true if the objects of a packfile layer exist in the
+// local repository. Layers without tips annotations are identified by the
+// references in the config. Layers identified by neither, e.g. layers repacked
+// by gc holding only trees and blobs, are skipped, as their objects are only
+// reachable through the commits of other layers.
+func layerExists(local *filesystem.Storage, cfg oci.ConfigGit, desc ocispec.Descriptor) (bool, error) {
+	if tips, ok := desc.Annotations[oci.AnnotationGitPackTips]; ok {
+		for _, tip := range strings.Split(tips, ",") {
+			exists, err := git.HasObject(local, plumbing.NewHash(tip))
+			if err != nil || !exists {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+
+	identified := false
+	for _, refs := range cfg.References() {
+		for _, info := range refs {
+			if info.Layer != desc.Digest {
+				continue
+			}
+			identified = true
+			exists, err := git.HasObject(local, info.Commit)
+			if err != nil || exists {
+				return exists, err
+			}
+		}
+	}
+	return !identified, nil
+}
+
+// layerIdentified returns true if the tips of a packfile layer are known, from
+// its tips annotation or the references in the config.
+func layerIdentified(cfg oci.ConfigGit, desc ocispec.Descriptor) bool {
+	if _, ok := desc.Annotations[oci.AnnotationGitPackTips]; ok {
+		return true
+	}
+	for _, refs := range cfg.References() {
+		for _, info := range refs {
+			if info.Layer == desc.Digest {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,234 @@
+package actions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"oras.land/oras-go/v2/content/memory"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+
+	"github.com/act3-ai/gitoci/internal/model"
+	"github.com/act3-ai/gitoci/pkg/oci"
+)
+
+// newTestStorage returns the storage of an empty in-memory repository.
+func newTestStorage() *filesystem.Storage {
+	return filesystem.NewStorage(memfs.New(), cache.NewObjectLRUDefault())
+}
+
+// testCommit stores a commit of an empty tree in st.
+func testCommit(t *testing.T, st *filesystem.Storage, msg string, parents ...plumbing.Hash) plumbing.Hash {
+	t.Helper()
+
+	treeObj := st.NewEncodedObject()
+	if err := (&object.Tree{}).Encode(treeObj); err != nil {
+		t.Fatalf("encoding tree: %v", err)
+	}
+	tree, err := st.SetEncodedObject(treeObj)
+	if err != nil {
+		t.Fatalf("storing tree: %v", err)
+	}
+
+	sig := object.Signature{Name: "Test", Email: "test@example.com", When: time.Unix(1700000000, 0).UTC()}
+	commit := &object.Commit{
+		Author:       sig,
+		Committer:    sig,
+		Message:      msg,
+		TreeHash:     tree,
+		ParentHashes: parents,
+	}
+	obj := st.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		t.Fatalf("encoding commit: %v", err)
+	}
+	h, err := st.SetEncodedObject(obj)
+	if err != nil {
+		t.Fatalf("storing commit: %v", err)
+	}
+	return h
+}
+
+func Test_layerExists(t *testing.T) {
+	local := newTestStorage()
+	present := testCommit(t, local, "present")
+	missing := plumbing.NewHash("2f5bc3b4ea8aa6a1e0ef4c3d9fdf3ea1a3a1e2c4")
+
+	cfg := oci.ConfigGit{
+		Heads: map[plumbing.ReferenceName]oci.ReferenceInfo{
+			"refs/heads/main":  {Commit: present, Layer: "sha256:1"},
+			"refs/heads/topic": {Commit: missing, Layer: "sha256:2"},
+		},
+	}
+
+	tests := []struct {
+		name string
+		desc ocispec.Descriptor
+		want bool
+	}{
+		{
+			name: "Tips Exist",
+			desc: ocispec.Descriptor{Digest: "sha256:3", Annotations: map[string]string{oci.AnnotationGitPackTips: present.String()}},
+			want: true,
+		},
+		{
+			name: "Tips Missing",
+			desc: ocispec.Descriptor{Digest: "sha256:3", Annotations: map[string]string{oci.AnnotationGitPackTips: present.String() + "," + missing.String()}},
+		},
+		{name: "Reference Exists", desc: ocispec.Descriptor{Digest: "sha256:1"}, want: true},
+		{name: "Reference Missing", desc: ocispec.Descriptor{Digest: "sha256:2"}},
+		{name: "Unidentified", desc: ocispec.Descriptor{Digest: "sha256:4"}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := layerExists(local, cfg, tt.desc)
+			if err != nil {
+				t.Fatalf("layerExists() error = %v", err)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_fetchLayers_unidentified(t *testing.T) {
+	ctx := context.Background()
+	local := newTestStorage()
+	head := testCommit(t, newTestStorage(), "head")
+
+	// a layer of trees and blobs repacked by gc, and the layer of the head
+	repacked := ocispec.Descriptor{MediaType: oci.MediaTypePackLayer, Digest: "sha256:1"}
+	layer := ocispec.Descriptor{
+		MediaType:   oci.MediaTypePackLayer,
+		Digest:      "sha256:2",
+		Annotations: map[string]string{oci.AnnotationGitPackTips: head.String()},
+	}
+	remote := model.NewModeler(memory.New())
+	if _, err := remote.Fetch(ctx, "v1"); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	remote.AddLayers(repacked, layer)
+	if err := remote.UpdateRef("refs/heads/main", oci.ReferenceInfo{Commit: head, Layer: layer.Digest}); err != nil {
+		t.Fatalf("UpdateRef() error = %v", err)
+	}
+	want := []*plumbing.Reference{plumbing.NewHashReference("refs/heads/main", head)}
+
+	got, err := fetchLayers(ctx, remote, local, want)
+	if err != nil {
+		t.Fatalf("fetchLayers() error = %v", err)
+	}
+	assert.Equal(t, []ocispec.Descriptor{repacked, layer}, got)
+
+	// fetched once the objects of the identified layers exist
+	testCommit(t, local, "head")
+	got, err = fetchLayers(ctx, remote, local, want)
+	if err != nil {
+		t.Fatalf("fetchLayers() error = %v", err)
+	}
+	assert.Empty(t, got)
+}
+
+func Test_selfContained(t *testing.T) {
+	ctx := context.Background()
+	base := testCommit(t, newTestStorage(), "base")
+	next := testCommit(t, newTestStorage(), "next", base)
+
+	// the first layer packs the history of the tag, the second the commit
+	// of the branch on top of it
+	first := ocispec.Descriptor{
+		MediaType:   oci.MediaTypePackLayer,
+		Digest:      "sha256:1",
+		Annotations: map[string]string{oci.AnnotationGitPackTips: base.String()},
+	}
+	second := ocispec.Descriptor{
+		MediaType:   oci.MediaTypePackLayer,
+		Digest:      "sha256:2",
+		Annotations: map[string]string{oci.AnnotationGitPackTips: next.String()},
+	}
+	remote := model.NewModeler(memory.New())
+	if _, err := remote.Fetch(ctx, "v1"); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	remote.AddLayers(first, second)
+	if err := remote.UpdateRef("refs/tags/v1", oci.ReferenceInfo{Commit: base, Layer: first.Digest}); err != nil {
+		t.Fatalf("UpdateRef() error = %v", err)
+	}
+	if err := remote.UpdateRef("refs/heads/main", oci.ReferenceInfo{Commit: next, Layer: second.Digest}); err != nil {
+		t.Fatalf("UpdateRef() error = %v", err)
+	}
+	main := plumbing.NewHashReference("refs/heads/main", next)
+	tag := plumbing.NewHashReference("refs/tags/v1", base)
+
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, local *filesystem.Storage)
+		want  []*plumbing.Reference
+		ok    bool
+	}{
+		{
+			name: "All Layers Indexed",
+			setup: func(t *testing.T, local *filesystem.Storage) {
+				testCommit(t, local, "base")
+				testCommit(t, local, "next", base)
+			},
+			want: []*plumbing.Reference{main, tag},
+			ok:   true,
+		},
+		{
+			name: "Layers Up To Wanted Indexed",
+			setup: func(t *testing.T, local *filesystem.Storage) {
+				testCommit(t, local, "base")
+			},
+			want: []*plumbing.Reference{tag},
+			ok:   true,
+		},
+		{
+			name: "Earlier Layer Missing",
+			setup: func(t *testing.T, local *filesystem.Storage) {
+				testCommit(t, local, "next", base)
+			},
+			want: []*plumbing.Reference{main},
+		},
+		{
+			name:  "Wanted Object Missing",
+			setup: func(*testing.T, *filesystem.Storage) {},
+			want:  []*plumbing.Reference{main},
+		},
+		{
+			name: "Unknown Reference",
+			setup: func(t *testing.T, local *filesystem.Storage) {
+				testCommit(t, local, "next", base)
+			},
+			want: []*plumbing.Reference{plumbing.NewHashReference("refs/heads/topic", next)},
+		},
+		{
+			name: "Shallow",
+			setup: func(t *testing.T, local *filesystem.Storage) {
+				testCommit(t, local, "base")
+				testCommit(t, local, "next", base)
+				if err := local.SetShallow([]plumbing.Hash{base}); err != nil {
+					t.Fatalf("SetShallow() error = %v", err)
+				}
+			},
+			want: []*plumbing.Reference{main},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local := newTestStorage()
+			tt.setup(t, local)
+
+			got, err := selfContained(ctx, remote, local, tt.want)
+			if err != nil {
+				t.Fatalf("selfContained() error = %v", err)
+			}
+			assert.Equal(t, tt.ok, got)
+		})
+	}
+}
@@ -0,0 +1,348 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/sync/errgroup"
+	"oras.land/oras-go/v2/content"
+
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+
+	"github.com/act3-ai/gitoci/internal/git"
+	"github.com/act3-ai/gitoci/internal/model"
+	"github.com/act3-ai/gitoci/internal/progress"
+	"github.com/act3-ai/gitoci/pkg/oci"
+)
+
+// GCOptions configure a garbage collection, see GC.
+type GCOptions struct {
+	// DeleteManifests are the digests of old manifests to delete from the
+	// registry, e.g. those printed by previous compactions.
+	DeleteManifests []string
+
+	// DeletePrevious deletes the manifest replaced by the garbage collection.
+	DeletePrevious bool
+
+	// DryRun reports what would be collected without modifying the remote.
+	DryRun bool
+}
+
+// gcLayer is the outcome of garbage collection for a packfile layer.
+type gcLayer struct {
+	desc ocispec.Descriptor
+
+	// objs are the objects of the layer still required, the layer is dropped
+	// if there are none
+	objs []plumbing.Hash
+
+	// repack is true if only some of the objects of the layer are required
+	repack bool
+}
+
+// GC drops the packfile layers of the remote that are not required to
+// reconstruct any of its references, e.g. after force pushes and deletions,
+// repacking layers that are only partially required. Replaced layers are
+// verified before the manifest is replaced, and old manifests are optionally
+// deleted. Layers pushed while collecting are kept. Unlike the other actions
+// it is not driven by Git.
+func (action *GitOCI) GC(ctx context.Context, opts GCOptions) error {
+	action.dryRun = opts.DryRun
+
+	ref, err := parseAddress(action.addess)
+	if err != nil {
+		return err
+	}
+
+	deletes := make([]digest.Digest, 0, len(opts.DeleteManifests))
+	for _, s := range opts.DeleteManifests {
+		dgst, err := digest.Parse(s)
+		if err != nil {
+			return fmt.Errorf("invalid manifest digest %s: %w", s, err)
+		}
+		deletes = append(deletes, dgst)
+	}
+
+	remote, err := action.fetchRemote(ctx)
+	switch {
+	case err != nil:
+		return err
+	case !remote.Exists():
+		return fmt.Errorf("remote %s does not exist", ref.String())
+	}
+
+	tmpDir, tmp, err := git.InitTemp("git-remote-oci-gc-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// every layer is needed to find which objects are no longer reachable
+	layers := remote.Layers()
+	layerObjs := make([][]plumbing.Hash, len(layers))
+	meter := action.meter("Receiving layers", len(layers))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(action.transferLimit())
+	for i, desc := range layers {
+		g.Go(func() error {
+			objs, err := indexLayerObjects(gctx, remote, tmp, desc, meter)
+			layerObjs[i] = objs
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err //nolint:wrapcheck
+	}
+	meter.Finish()
+
+	cfg := remote.Config()
+	var want []plumbing.Hash
+	for _, refs := range cfg.References() {
+		for _, info := range refs {
+			want = append(want, info.Commit)
+		}
+	}
+	reachable, err := git.ReachableObjects(tmp, want)
+	if err != nil {
+		return err
+	}
+
+	plan := planGC(layers, layerObjs, reachable)
+	kept, replaced, err := action.collectLayers(ctx, remote, tmpDir, plan)
+	if err != nil {
+		return err
+	}
+
+	dropped, repacked := 0, 0
+	for _, l := range plan {
+		switch {
+		case len(l.objs) == 0:
+			dropped++
+		case l.repack:
+			repacked++
+		}
+	}
+	slog.DebugContext(ctx, "collected layers", "layers", len(layers), "dropped", dropped, "repacked", repacked, "reachable", len(reachable))
+
+	before := progress.HumanBytes(float64(layersSize(layers)))
+	after := progress.HumanBytes(float64(layersSize(kept)))
+	prev := remote.Manifest()
+	switch {
+	case dropped == 0 && repacked == 0:
+		if _, err := fmt.Fprintf(action.out, "Nothing to collect, %d layers\n", len(layers)); err != nil {
+			return err
+		}
+	case action.dryRun:
+		if _, err := fmt.Fprintf(action.out, "Would drop %d and repack %d of %d layers, %s -> %s\n", dropped, repacked, len(layers), before, after); err != nil {
+			return err
+		}
+		if opts.DeletePrevious {
+			deletes = append(deletes, prev.Digest)
+		}
+	default:
+		annotations := map[string]string{
+			oci.AnnotationGitRemoteOCIVersion: action.version,
+		}
+		desc, err := action.pushManifest(ctx, remote, ref, annotations, func(int) (bool, error) {
+			// objects of layers pushed concurrently may only be reachable
+			// from the new references, they are kept as they are
+			newer, err := newerLayers(remote, layers)
+			if err != nil {
+				return false, fmt.Errorf("updating remote %s: %w, collect again", ref.String(), err)
+			}
+			if err := relinkRefs(remote, replaced); err != nil {
+				return false, err
+			}
+			prev = remote.Manifest()
+			annotations[oci.AnnotationGitCollectedFrom] = prev.Digest.String()
+			remote.SetLayers(slices.Concat(kept, newer)...)
+			return true, nil
+		})
+		if err != nil {
+			return err
+		}
+		slog.InfoContext(ctx, "collected remote", "reference", ref.String(), "digest", desc.Digest, "previous", prev.Digest)
+
+		_, err = fmt.Fprintf(action.out, "Dropped %d and repacked %d of %d layers, %s -> %s\nPrevious manifest: %s/%s@%s\n",
+			dropped, repacked, len(layers), before, after, ref.Registry, ref.Repository, prev.Digest)
+		if err != nil {
+			return err
+		}
+		if opts.DeletePrevious {
+			deletes = append(deletes, prev.Digest)
+		}
+	}
+
+	return action.deleteManifests(ctx, remote, deletes)
+}
+
+// indexLayerObjects fetches a packfile layer into storage, returning the
+// objects it contains.
+func indexLayerObjects(ctx context.Context, remote model.Modeler, st *filesystem.Storage, desc ocispec.Descriptor, meter *progress.Meter) ([]plumbing.Hash, error) {
+	slog.DebugContext(ctx, "fetching packfile layer", "layer", desc.Digest, "size", desc.Size)
+
+	rc, err := remote.FetchLayer(ctx, desc)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	vr := content.NewVerifyReader(rc, desc)
+	objs, err := git.IndexPackObjects(st, meter.Reader(vr))
+	if err != nil {
+		return nil, fmt.Errorf("indexing layer %s: %w", desc.Digest, err)
+	}
+	if err := vr.Verify(); err != nil {
+		return nil, fmt.Errorf("verifying layer %s: %w", desc.Digest, err)
+	}
+	meter.LayerDone()
+
+	return objs, nil
+}
+
+// planGC determines the objects still required from each layer, those
+// reachable from a reference that an older layer doesn't already contain.
+func planGC(layers []ocispec.Descriptor, layerObjs [][]plumbing.Hash, reachable map[plumbing.Hash]struct{}) []gcLayer {
+	plan := make([]gcLayer, 0, len(layers))
+	seen := make(map[plumbing.Hash]struct{}, len(reachable))
+	for i, desc := range layers {
+		var objs []plumbing.Hash
+		for _, h := range layerObjs[i] {
+			if _, ok := reachable[h]; !ok {
+				continue
+			}
+			if _, ok := seen[h]; ok {
+				continue
+			}
+			seen[h] = struct{}{}
+			objs = append(objs, h)
+		}
+		plan = append(plan, gcLayer{
+			desc:   desc,
+			objs:   objs,
+			repack: len(objs) > 0 && len(objs) < len(layerObjs[i]),
+		})
+	}
+	return plan
+}
+
+// collectLayers carries out a garbage collection plan, repacking layers as
+// needed from the temporary repository in tmpDir. It returns the layers to
+// keep, in order, and the replacement of each layer that was repacked or
+// dropped. Dropped layers are replaced by the closest older layer kept, as they
+// contributed nothing references require.
+func (action *GitOCI) collectLayers(ctx context.Context, remote model.Modeler, tmpDir string, plan []gcLayer) ([]ocispec.Descriptor, map[digest.Digest]digest.Digest, error) {
+	count := 0
+	for _, l := range plan {
+		if l.repack {
+			count++
+		}
+	}
+
+	repacked := make([]ocispec.Descriptor, len(plan))
+	meter := action.meter("Writing layers", count)
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(action.transferLimit())
+	for i, l := range plan {
+		if !l.repack {
+			continue
+		}
+		g.Go(func() error {
+			desc, err := action.repackLayer(gctx, remote, tmpDir, l.objs, meter)
+			repacked[i] = desc
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, nil, err //nolint:wrapcheck
+	}
+	meter.Finish()
+
+	kept := make([]ocispec.Descriptor, 0, len(plan))
+	replaced := make(map[digest.Digest]digest.Digest)
+	var pending []digest.Digest // dropped layers older than any kept
+	for i, l := range plan {
+		if len(l.objs) == 0 {
+			if len(kept) == 0 {
+				pending = append(pending, l.desc.Digest)
+				continue
+			}
+			replaced[l.desc.Digest] = kept[len(kept)-1].Digest
+			continue
+		}
+
+		desc := l.desc
+		if l.repack {
+			desc = repacked[i]
+			replaced[l.desc.Digest] = desc.Digest
+		}
+
+		for _, dgst := range pending {
+			replaced[dgst] = desc.Digest
+		}
+		pending = nil
+		kept = append(kept, desc)
+	}
+	return kept, replaced, nil
+}
+
+// repackLayer pushes a packfile layer of objs, read from the temporary
+// repository in tmpDir, verifying it unless in a dry run. Storage is not safe
+// for concurrent reads, so each repack opens its own.
+func (action *GitOCI) repackLayer(ctx context.Context, remote model.Modeler, tmpDir string, objs []plumbing.Hash, meter *progress.Meter) (ocispec.Descriptor, error) {
+	tmp := filesystem.NewStorage(osfs.New(tmpDir), cache.NewObjectLRUDefault())
+	defer tmp.Close()
+
+	tips, err := git.Tips(tmp, objs)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	desc, err := action.pushLayer(ctx, remote, packObjects(ctx, tmpDir, tmp, objs), objs, hashStrings(tips), meter)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	if !action.dryRun {
+		if err := verifyLayer(ctx, remote, desc, objs); err != nil {
+			return ocispec.Descriptor{}, err
+		}
+	}
+	return desc, nil
+}
+
+// deleteManifests deletes old manifests from the registry.
+func (action *GitOCI) deleteManifests(ctx context.Context, remote model.Modeler, digests []digest.Digest) error {
+	for _, dgst := range digests {
+		if action.dryRun {
+			if _, err := fmt.Fprintf(action.out, "Would delete manifest %s\n", dgst); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := remote.DeleteManifest(ctx, dgst); err != nil {
+			return err
+		}
+		slog.InfoContext(ctx, "deleted manifest", "digest", dgst)
+		if _, err := fmt.Fprintf(action.out, "Deleted manifest %s\n", dgst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hashStrings formats object IDs as strings.
+func hashStrings(hashes []plumbing.Hash) []string {
+	s := make([]string, 0, len(hashes))
+	for _, h := range hashes {
+		s = append(s, h.String())
+	}
+	return s
+}
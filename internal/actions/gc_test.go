@@ -0,0 +1,175 @@
+package actions
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"oras.land/oras-go/v2/content/memory"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func Test_planGC(t *testing.T) {
+	var (
+		a = plumbing.NewHash("2f5bc3b4ea8aa6a1e0ef4c3d9fdf3ea1a3a1e2c4")
+		b = plumbing.NewHash("9d1f2b7e1a4c6a3b5e2d7f8c9b0a1e2d3c4b5a6f")
+		c = plumbing.NewHash("0a1b2c3d4e5f60718293a4b5c6d7e8f901234567")
+	)
+	layers := []ocispec.Descriptor{{Digest: "sha256:1"}, {Digest: "sha256:2"}, {Digest: "sha256:3"}}
+
+	tests := []struct {
+		name      string
+		layerObjs [][]plumbing.Hash
+		reachable []plumbing.Hash
+		want      []gcLayer
+	}{
+		{
+			name:      "All Required",
+			layerObjs: [][]plumbing.Hash{{a}, {b}, {c}},
+			reachable: []plumbing.Hash{a, b, c},
+			want: []gcLayer{
+				{desc: layers[0], objs: []plumbing.Hash{a}},
+				{desc: layers[1], objs: []plumbing.Hash{b}},
+				{desc: layers[2], objs: []plumbing.Hash{c}},
+			},
+		},
+		{
+			name:      "Unreachable Layer",
+			layerObjs: [][]plumbing.Hash{{a}, {b}, {c}},
+			reachable: []plumbing.Hash{a, c},
+			want: []gcLayer{
+				{desc: layers[0], objs: []plumbing.Hash{a}},
+				{desc: layers[1]},
+				{desc: layers[2], objs: []plumbing.Hash{c}},
+			},
+		},
+		{
+			name:      "Partially Required",
+			layerObjs: [][]plumbing.Hash{{a}, {b, c}, {}},
+			reachable: []plumbing.Hash{a, c},
+			want: []gcLayer{
+				{desc: layers[0], objs: []plumbing.Hash{a}},
+				{desc: layers[1], objs: []plumbing.Hash{c}, repack: true},
+				{desc: layers[2]},
+			},
+		},
+		{
+			name:      "Duplicate Objects",
+			layerObjs: [][]plumbing.Hash{{a, b}, {b, c}, {c}},
+			reachable: []plumbing.Hash{a, b, c},
+			want: []gcLayer{
+				{desc: layers[0], objs: []plumbing.Hash{a, b}},
+				{desc: layers[1], objs: []plumbing.Hash{c}, repack: true},
+				{desc: layers[2]},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reachable := make(map[plumbing.Hash]struct{}, len(tt.reachable))
+			for _, h := range tt.reachable {
+				reachable[h] = struct{}{}
+			}
+			assert.Equal(t, tt.want, planGC(layers, tt.layerObjs, reachable))
+		})
+	}
+}
+
+// deletingStore is an in-memory store recording the manifests deleted from
+// it. Unlike the memory store, it resolves content by digest and supports
+// deletion, as registries do.
+type deletingStore struct {
+	*memory.Store
+
+	mu      sync.Mutex
+	pushed  map[digest.Digest]ocispec.Descriptor
+	deleted []digest.Digest
+}
+
+// newDeletingStore returns an empty deletingStore.
+func newDeletingStore() *deletingStore {
+	return &deletingStore{
+		Store:  memory.New(),
+		pushed: make(map[digest.Digest]ocispec.Descriptor),
+	}
+}
+
+// Push implements content.Pusher.
+func (s *deletingStore) Push(ctx context.Context, expected ocispec.Descriptor, r io.Reader) error {
+	s.mu.Lock()
+	s.pushed[expected.Digest] = expected
+	s.mu.Unlock()
+	return s.Store.Push(ctx, expected, r) //nolint:wrapcheck
+}
+
+// Resolve implements content.Resolver.
+func (s *deletingStore) Resolve(ctx context.Context, reference string) (ocispec.Descriptor, error) {
+	s.mu.Lock()
+	desc, ok := s.pushed[digest.Digest(reference)]
+	s.mu.Unlock()
+	if ok {
+		return desc, nil
+	}
+	return s.Store.Resolve(ctx, reference) //nolint:wrapcheck
+}
+
+// Delete implements content.Deleter.
+func (s *deletingStore) Delete(_ context.Context, target ocispec.Descriptor) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleted = append(s.deleted, target.Digest)
+	return nil
+}
+
+func TestGitOCI_GC(t *testing.T) {
+	store := newDeletingStore()
+	local := newTestStorage()
+	action, _ := newRemoteAction(t, store, local)
+
+	base := testCommit(t, local, "base")
+	topic := testCommit(t, local, "topic", base)
+	other := testCommit(t, local, "other", base)
+
+	// the manifest of the first push is orphaned by the next
+	pushCommit(t, action, "refs/heads/main", base)
+	orphan := action.remote.Manifest().Digest
+	// the layer of a deleted branch is unreachable
+	pushCommit(t, action, "refs/heads/topic", topic)
+	pushCommit(t, action, "refs/heads/topic", plumbing.ZeroHash)
+	layers := layerDigests(action.remote)
+
+	gc, out := newRemoteAction(t, store, local)
+	var prev digest.Digest
+	gc.remote = &racingModeler{
+		Modeler: gc.remote,
+		race: func() {
+			concurrent, _ := newRemoteAction(t, store, local)
+			pushCommit(t, concurrent, "refs/heads/other", other)
+			prev = concurrent.remote.Manifest().Digest
+		},
+	}
+
+	opts := GCOptions{DeleteManifests: []string{orphan.String()}, DeletePrevious: true}
+	if err := gc.GC(context.Background(), opts); err != nil {
+		t.Fatalf("GC() error = %v", err)
+	}
+	assert.Contains(t, out.String(), "Dropped 1 and repacked 0 of 2 layers")
+
+	remote, _ := newRemoteAction(t, store, local)
+	got := layerDigests(remote.remote)
+	cfg := remote.remote.Config()
+	// the concurrently pushed layer is kept
+	assert.Len(t, got, 2)
+	assert.Equal(t, layers[0], got[0])
+	assert.Equal(t, got[0], cfg.Heads["refs/heads/main"].Layer)
+	assert.Equal(t, got[1], cfg.Heads["refs/heads/other"].Layer)
+	assert.NotContains(t, cfg.Heads, plumbing.ReferenceName("refs/heads/topic"))
+
+	// the orphaned manifest and the manifest replaced by gc are deleted
+	assert.Equal(t, []digest.Digest{orphan, prev}, store.deleted)
+}
@@ -0,0 +1,57 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/act3-ai/gitoci/internal/model"
+	"github.com/act3-ai/gitoci/pkg/oci"
+)
+
+// SetHead sets the branch the remote HEAD refers to, which must exist in the
+// remote. Unlike the other actions it is not driven by Git.
+func (action *GitOCI) SetHead(ctx context.Context, branch string) error {
+	name := plumbing.NewBranchReferenceName(strings.TrimPrefix(branch, "refs/heads/"))
+
+	ref, err := parseAddress(action.addess)
+	if err != nil {
+		return err
+	}
+
+	remote, err := action.fetchRemote(ctx)
+	if err != nil {
+		return err
+	}
+
+	annotations := map[string]string{
+		oci.AnnotationGitRemoteOCIVersion: action.version,
+	}
+	for attempt := 1; ; attempt++ {
+		if remote.Config().Head == name {
+			slog.InfoContext(ctx, "remote HEAD unchanged", "reference", ref.String(), "head", name)
+			return nil
+		}
+		if err := remote.SetHead(name); err != nil {
+			return err
+		}
+
+		desc, err := remote.Push(ctx, ref.Reference, annotations)
+		switch {
+		case err == nil:
+			slog.InfoContext(ctx, "updated remote HEAD", "reference", ref.String(), "head", name, "digest", desc.Digest)
+			return nil
+		case !errors.Is(err, model.ErrConflict) || attempt >= maxPushAttempts:
+			return fmt.Errorf("updating remote %s: %w", ref.String(), err)
+		}
+
+		slog.InfoContext(ctx, "remote modified concurrently, retrying", "reference", ref.String(), "attempt", attempt)
+		if _, err := remote.Fetch(ctx, ref.Reference); err != nil {
+			return fmt.Errorf("refetching remote %s: %w", ref.String(), err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/act3-ai/gitoci/internal/cmd"
+)
+
+// importRefs handles a batch of 'import' commands, writing a fast-import
+// stream that updates the private references of the remote.
+//
+// Packfile layers are indexed directly in the local repository, which
+// fast-import shares, so the stream only needs to point references at them.
+//
+// https://git-scm.com/docs/gitremote-helpers#Documentation/gitremote-helpers.txt-importname
+func (action *GitOCI) importRefs(ctx context.Context, cmds []cmd.Git) error {
+	slog.DebugContext(ctx, "handling import batch", "count", len(cmds))
+
+	remote, err := action.fetchRemote(ctx)
+	if err != nil {
+		return err
+	}
+
+	local, err := action.openLocal()
+	if err != nil {
+		return err
+	}
+
+	cfg := remote.Config()
+	want := make([]*plumbing.Reference, 0, len(cmds))
+	for _, c := range cmds {
+		name := c.Data[0]
+		if name == plumbing.HEAD.String() {
+			name = remoteHead(cfg).String()
+		}
+
+		h, err := resolveRemoteName(cfg, name)
+		if err != nil {
+			return err
+		}
+		want = append(want, plumbing.NewHashReference(plumbing.ReferenceName(name), h))
+	}
+
+	if err := action.fetchRefs(ctx, remote, local, want); err != nil {
+		return err
+	}
+
+	lines := []string{"feature done"}
+	for _, ref := range want {
+		private := action.privateRef(ref.Name())
+
+		obj, err := local.EncodedObject(plumbing.AnyObject, ref.Hash())
+		if err != nil {
+			return fmt.Errorf("resolving object %s of %s: %w", ref.Hash(), ref.Name(), err)
+		}
+		if obj.Type() != plumbing.CommitObject {
+			// fast-import peels annotated tags when resetting a reference
+			if err := local.SetReference(plumbing.NewHashReference(private, ref.Hash())); err != nil {
+				return fmt.Errorf("updating reference %s: %w", private, err)
+			}
+			continue
+		}
+
+		lines = append(lines,
+			fmt.Sprintf("reset %s", private),
+			fmt.Sprintf("from %s", ref.Hash()),
+			"")
+	}
+	lines = append(lines, "done")
+
+	for _, line := range lines {
+		if err := action.batcher.Write(line); err != nil {
+			return fmt.Errorf("writing fast-import stream: %w", err)
+		}
+	}
+	// the stream ends with 'done', anything following would be read by Git
+	if err := action.batcher.Flush(false); err != nil {
+		return fmt.Errorf("writing fast-import stream: %w", err)
+	}
+
+	return nil
+}
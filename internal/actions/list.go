@@ -0,0 +1,138 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/act3-ai/gitoci/internal/cmd"
+	"github.com/act3-ai/gitoci/pkg/oci"
+)
+
+// defaultHeads are the branches, in order of preference, advertised as the
+// remote HEAD.
+var defaultHeads = []plumbing.ReferenceName{
+	plumbing.Main,
+	plumbing.Master,
+}
+
+// list handles the 'list' and 'list for-push' commands.
+//
+// https://git-scm.com/docs/gitremote-helpers#Documentation/gitremote-helpers.txt-list
+func (action *GitOCI) list(ctx context.Context, c cmd.Git) error {
+	slog.DebugContext(ctx, "handling list", "subcommand", c.SubCmd)
+
+	cfg, err := action.listConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	// peeled tags let Git follow the tags of the commits it fetches
+	lines := listRefs(cfg, c.SubCmd != cmd.ListForPush)
+	if action.objectFormat {
+		// must precede the references
+		lines = append([]string{fmt.Sprintf(":object-format %s", cfg.ObjectFormat)}, lines...)
+	}
+	slog.DebugContext(ctx, "writing remote references", "count", len(lines))
+	if err := action.batcher.WriteBatch(lines...); err != nil {
+		return fmt.Errorf("writing list response: %w", err)
+	}
+
+	return nil
+}
+
+// listConfig returns the config of the remote to list. While the remote
+// manifest is the one the private references were last updated from, they
+// are listed instead, so the manifest is only resolved rather than it and the
+// config fetched.
+func (action *GitOCI) listConfig(ctx context.Context) (oci.ConfigGit, error) {
+	if action.remote != nil || action.gitDir == "" {
+		remote, err := action.fetchRemote(ctx)
+		if err != nil {
+			return oci.ConfigGit{}, err
+		}
+		return remote.Config(), nil
+	}
+
+	ref, err := parseAddress(action.addess)
+	if err != nil {
+		return oci.ConfigGit{}, err
+	}
+	modeler, err := action.newModeler(ref)
+	if err != nil {
+		return oci.ConfigGit{}, err
+	}
+
+	if _, err := os.Stat(filepath.Join(action.privateDir(), manifestFile)); err == nil {
+		desc, err := modeler.Resolve(ctx, ref.Reference)
+		if err != nil {
+			return oci.ConfigGit{}, fmt.Errorf("resolving remote %s: %w", ref.String(), err)
+		}
+		local, err := action.openLocal()
+		if err != nil {
+			return oci.ConfigGit{}, err
+		}
+		cfg, ok, err := action.privateConfig(local, desc.Digest)
+		switch {
+		case err != nil:
+			return oci.ConfigGit{}, err
+		case ok:
+			slog.DebugContext(ctx, "remote unchanged, listing private references", "digest", desc.Digest)
+			return cfg, nil
+		}
+	}
+
+	if err := action.loadRemote(ctx, ref, modeler); err != nil {
+		return oci.ConfigGit{}, err
+	}
+	return modeler.Config(), nil
+}
+
+// listRefs formats the references of a Git OCI config as a list response,
+// optionally including the peeled objects of annotated tags. An empty config
+// results in an empty list.
+func listRefs(cfg oci.ConfigGit, peeled bool) []string {
+	lines := make([]string, 0, len(cfg.Heads)+len(cfg.Tags)+len(cfg.Refs)+1)
+	for _, refs := range cfg.References() {
+		for _, name := range slices.Sorted(maps.Keys(refs)) {
+			info := refs[name]
+			lines = append(lines, fmt.Sprintf("%s %s", info.Commit, name))
+			if peeled && !info.Peeled.IsZero() {
+				lines = append(lines, fmt.Sprintf("%s %s^{}", info.Peeled, name))
+			}
+		}
+	}
+
+	if head := remoteHead(cfg); head != "" {
+		lines = append(lines, fmt.Sprintf("@%s %s", head, plumbing.HEAD))
+	}
+
+	return lines
+}
+
+// remoteHead selects the branch advertised as the remote HEAD, preferring the
+// head recorded in the config, returning an empty name if the remote does not
+// have any branches.
+func remoteHead(cfg oci.ConfigGit) plumbing.ReferenceName {
+	if _, ok := cfg.Heads[cfg.Head]; ok {
+		return cfg.Head
+	}
+
+	for _, name := range defaultHeads {
+		if _, ok := cfg.Heads[name]; ok {
+			return name
+		}
+	}
+
+	heads := slices.Sorted(maps.Keys(cfg.Heads))
+	if len(heads) > 0 {
+		return heads[0]
+	}
+	return ""
+}
@@ -0,0 +1,103 @@
+package actions
+
+import (
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/act3-ai/gitoci/pkg/oci"
+)
+
+func Test_remoteHead(t *testing.T) {
+	heads := func(names ...plumbing.ReferenceName) map[plumbing.ReferenceName]oci.ReferenceInfo {
+		refs := make(map[plumbing.ReferenceName]oci.ReferenceInfo, len(names))
+		for _, name := range names {
+			refs[name] = oci.ReferenceInfo{}
+		}
+		return refs
+	}
+
+	tests := []struct {
+		name string
+		cfg  oci.ConfigGit
+		want plumbing.ReferenceName
+	}{
+		{
+			name: "Recorded Head",
+			cfg:  oci.ConfigGit{Head: "refs/heads/trunk", Heads: heads("refs/heads/main", "refs/heads/trunk")},
+			want: "refs/heads/trunk",
+		},
+		{
+			name: "Recorded Head Missing",
+			cfg:  oci.ConfigGit{Head: "refs/heads/trunk", Heads: heads("refs/heads/master", "refs/heads/main")},
+			want: "refs/heads/main",
+		},
+		{
+			name: "Default Head",
+			cfg:  oci.ConfigGit{Heads: heads("refs/heads/feature", "refs/heads/master")},
+			want: "refs/heads/master",
+		},
+		{
+			name: "First Head",
+			cfg:  oci.ConfigGit{Heads: heads("refs/heads/b", "refs/heads/a")},
+			want: "refs/heads/a",
+		},
+		{
+			name: "No Heads",
+			cfg:  oci.ConfigGit{},
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, remoteHead(tt.cfg))
+		})
+	}
+}
+
+func Test_listRefs(t *testing.T) {
+	commit := plumbing.NewHash("3e6bbf54251de3d3e6ca92fe3df5ebde10c5c0b1")
+	tag := plumbing.NewHash("03506a2dd66e23b640eda029638eb9210bd2b353")
+	cfg := oci.ConfigGit{
+		Heads: map[plumbing.ReferenceName]oci.ReferenceInfo{
+			"refs/heads/main": {Commit: commit},
+		},
+		Tags: map[plumbing.ReferenceName]oci.ReferenceInfo{
+			"refs/tags/v1": {Commit: tag, Peeled: commit},
+			"refs/tags/v2": {Commit: commit},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		peeled bool
+		want   []string
+	}{
+		{
+			name:   "Peeled",
+			peeled: true,
+			want: []string{
+				commit.String() + " refs/heads/main",
+				tag.String() + " refs/tags/v1",
+				commit.String() + " refs/tags/v1^{}",
+				commit.String() + " refs/tags/v2",
+				"@refs/heads/main HEAD",
+			},
+		},
+		{
+			name: "For Push",
+			want: []string{
+				commit.String() + " refs/heads/main",
+				tag.String() + " refs/tags/v1",
+				commit.String() + " refs/tags/v2",
+				"@refs/heads/main HEAD",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, listRefs(cfg, tt.peeled))
+		})
+	}
+}
@@ -6,11 +6,49 @@ import (
 	"fmt"
 	"log/slog"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	format "github.com/go-git/go-git/v5/plumbing/format/config"
 
 	"github.com/act3-ai/gitoci/internal/cmd"
+	"github.com/act3-ai/gitoci/internal/git"
 )
 
+// Option holds the values of options set by Git.
 type Option struct {
+	// cas maps references to the object IDs they are expected to have in
+	// the remote, a zero hash if they are expected not to exist.
+	cas map[plumbing.ReferenceName]plumbing.Hash
+
+	// shallow fetch limits, see shallow
+	depth       int
+	deepenSince time.Time
+	deepenNot   []string
+
+	// deepenRelative counts depth from the shallow commits of the local
+	// repository rather than the fetched references
+	deepenRelative bool
+
+	// progress enables progress reporting, see meter
+	progress bool
+
+	// dryRun disables modifications to the remote
+	dryRun bool
+
+	// atomic requires all reference updates in a push to succeed or fail together
+	atomic bool
+
+	// force allows exported reference updates that discard remote history,
+	// push commands indicate this per reference
+	force bool
+
+	// objectFormat reports the remote's object format in list output
+	objectFormat bool
+
+	// checkConnectivity requests proof that a clone is connected, see selfContained
+	checkConnectivity bool
 }
 
 // option handles and responds to the option subcommands.
@@ -31,8 +69,8 @@ func (action *GitOCI) option(ctx context.Context, c cmd.Git) error {
 		slog.DebugContext(ctx, "received unsupported option command", "command", c.SubCmd)
 		result = unsupported
 	case err != nil:
-		slog.ErrorContext(ctx, "failed to handle option command", "command", c.SubCmd)
-		result = err.Error()
+		slog.ErrorContext(ctx, "failed to handle option command", "command", c.SubCmd, "error", err.Error())
+		result = "error " + err.Error()
 	default:
 		slog.DebugContext(ctx, "successfully handled option command", "command", c.SubCmd)
 		result = ok
@@ -57,6 +95,31 @@ func (action *GitOCI) handleOption(ctx context.Context, name cmd.Type, value str
 	switch name {
 	case cmd.OptionVerbosity:
 		return action.verbosity(value)
+	case cmd.OptionCAS:
+		return action.compareAndSwap(value)
+	case cmd.OptionDepth:
+		return action.setDepth(value)
+	case cmd.OptionDeepenSince:
+		return action.setDeepenSince(value)
+	case cmd.OptionDeepenNot:
+		action.deepenNot = append(action.deepenNot, value)
+		return nil
+	case cmd.OptionDeepenRel:
+		return action.setDeepenRelative(value)
+	case cmd.OptionProgress:
+		return action.setProgress(value)
+	case cmd.OptionDryRun:
+		return action.setDryRun(value)
+	case cmd.OptionAtomic:
+		return action.setAtomic(value)
+	case cmd.OptionForce:
+		return action.setForce(value)
+	case cmd.OptionObjectFormat:
+		return action.setObjectFormat(value)
+	case cmd.OptionCheckConn:
+		return action.setCheckConnectivity(value)
+	case cmd.OptionPushCert:
+		return action.setPushCert(value)
 	default:
 		// sanity, should never happen
 		slog.DebugContext(ctx, "handleOption not able to handle supposedly supported option command", "command", name)
@@ -90,3 +153,198 @@ func (action *GitOCI) verbosity(value string) error {
 
 	return nil
 }
+
+// compareAndSwap handles the 'option cas' command.
+//
+// https://git-scm.com/docs/gitremote-helpers#Documentation/gitremote-helpers.txt-optioncasrefnameexpected
+func (action *GitOCI) compareAndSwap(value string) error {
+	name, expected, ok := strings.Cut(value, ":")
+	switch {
+	case !ok || name == "":
+		return fmt.Errorf("invalid cas value %s, expected <refname>:<expected-oid>", value)
+	case !plumbing.IsHash(expected):
+		return fmt.Errorf("invalid expected object ID %s for reference %s", expected, name)
+	}
+
+	if action.cas == nil {
+		action.cas = make(map[plumbing.ReferenceName]plumbing.Hash)
+	}
+	action.cas[plumbing.ReferenceName(name)] = plumbing.NewHash(expected)
+
+	return nil
+}
+
+// setProgress handles the 'option progress' command.
+//
+// https://git-scm.com/docs/gitremote-helpers#Documentation/gitremote-helpers.txt-optionprogresstruefalse
+func (action *GitOCI) setProgress(value string) error {
+	progress, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("converting progress value to bool: %w", err)
+	}
+
+	action.progress = progress
+	return nil
+}
+
+// setDryRun handles the 'option dry-run' command.
+//
+// https://git-scm.com/docs/gitremote-helpers#Documentation/gitremote-helpers.txt-optiondry-runtruefalse
+func (action *GitOCI) setDryRun(value string) error {
+	dryRun, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("converting dry-run value to bool: %w", err)
+	}
+
+	action.dryRun = dryRun
+	return nil
+}
+
+// setAtomic handles the 'option atomic' command.
+//
+// https://git-scm.com/docs/gitremote-helpers#Documentation/gitremote-helpers.txt-optionatomictruefalse
+func (action *GitOCI) setAtomic(value string) error {
+	atomic, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("converting atomic value to bool: %w", err)
+	}
+
+	action.atomic = atomic
+	return nil
+}
+
+// setForce handles the 'option force' command, sent before an export.
+//
+// https://git-scm.com/docs/gitremote-helpers#Documentation/gitremote-helpers.txt-optionforcetruefalse
+func (action *GitOCI) setForce(value string) error {
+	force, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("converting force value to bool: %w", err)
+	}
+
+	action.force = force
+	return nil
+}
+
+// setCheckConnectivity handles the 'option check-connectivity' command.
+//
+// https://git-scm.com/docs/gitremote-helpers#Documentation/gitremote-helpers.txt-optioncheck-connectivitytruefalse
+func (action *GitOCI) setCheckConnectivity(value string) error {
+	check, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("converting check-connectivity value to bool: %w", err)
+	}
+
+	action.checkConnectivity = check
+	return nil
+}
+
+// setObjectFormat handles the 'option object-format' command. A value other
+// than true is the object format Git intends to use, which must be supported.
+//
+// https://git-scm.com/docs/gitremote-helpers#Documentation/gitremote-helpers.txt-optionobject-formattruealgorithm
+func (action *GitOCI) setObjectFormat(value string) error {
+	if value != "true" && format.ObjectFormat(value) != git.SupportedFormat {
+		return fmt.Errorf("unsupported object format %s, expected %s%s", value, git.SupportedFormat, git.FormatHint(format.ObjectFormat(value)))
+	}
+
+	action.objectFormat = true
+	return nil
+}
+
+// setDepth handles the 'option depth' command.
+//
+// https://git-scm.com/docs/gitremote-helpers#Documentation/gitremote-helpers.txt-optiondepthdepth
+func (action *GitOCI) setDepth(value string) error {
+	depth, err := strconv.Atoi(value)
+	switch {
+	case err != nil:
+		return fmt.Errorf("converting depth value to int: %w", err)
+	case depth < 0:
+		return fmt.Errorf("invalid depth %d, must not be negative", depth)
+	}
+
+	action.depth = depth
+	return nil
+}
+
+// setDeepenSince handles the 'option deepen-since' command.
+//
+// https://git-scm.com/docs/gitremote-helpers#Documentation/gitremote-helpers.txt-optiondeepen-sinceltdategt
+func (action *GitOCI) setDeepenSince(value string) error {
+	since, err := parseDate(value, time.Now())
+	if err != nil {
+		return err
+	}
+
+	action.deepenSince = since
+	return nil
+}
+
+// setDeepenRelative handles the 'option deepen-relative' command, sent with
+// 'option depth' by git fetch --deepen.
+//
+// https://git-scm.com/docs/gitremote-helpers#Documentation/gitremote-helpers.txt-optiondeepen-relativetruefalse
+func (action *GitOCI) setDeepenRelative(value string) error {
+	relative, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("converting deepen-relative value to bool: %w", err)
+	}
+
+	action.deepenRelative = relative
+	return nil
+}
+
+// shallow returns true if any shallow fetch limits are set.
+func (o *Option) shallow() bool {
+	return o.depth > 0 || !o.deepenSince.IsZero() || len(o.deepenNot) > 0
+}
+
+// dateUnits are the units supported in relative dates.
+var dateUnits = map[string]time.Duration{
+	"second": time.Second,
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+	"week":   7 * 24 * time.Hour,
+	"month":  30 * 24 * time.Hour,
+	"year":   365 * 24 * time.Hour,
+}
+
+// dateFormats describes the date formats accepted by parseDate.
+const dateFormats = `a unix timestamp, an ISO 8601 date such as 2006-01-02 or 2006-01-02T15:04:05Z, ` +
+	`a relative date such as "2 weeks ago" or "2.weeks.ago", "yesterday" or "now"`
+
+// parseDate parses the subset of Git's date formats expected in shallow fetches:
+// unix timestamps, ISO 8601 dates, and relative dates such as "2 weeks ago".
+// As in Git, the words of relative dates may be separated by dots, e.g.
+// "2.weeks.ago".
+func parseDate(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+
+	if ts, err := strconv.ParseInt(strings.TrimPrefix(value, "@"), 10, 64); err == nil {
+		return time.Unix(ts, 0), nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	fields := strings.Fields(strings.ToLower(strings.ReplaceAll(value, ".", " ")))
+	switch {
+	case len(fields) == 1 && fields[0] == "now":
+		return now, nil
+	case len(fields) == 1 && fields[0] == "yesterday":
+		return now.Add(-dateUnits["day"]), nil
+	case len(fields) == 3 && fields[2] == "ago":
+		n, err := strconv.Atoi(fields[0])
+		unit, ok := dateUnits[strings.TrimSuffix(fields[1], "s")]
+		if err == nil && n >= 0 && ok {
+			return now.Add(-time.Duration(n) * unit), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unsupported date %q, expected %s", value, dateFormats)
+}
@@ -0,0 +1,80 @@
+package actions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseDate(t *testing.T) {
+	now := time.Date(2025, time.June, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{
+			name:  "Unix Timestamp",
+			value: "1749988800",
+			want:  time.Unix(1749988800, 0),
+		},
+		{
+			name:  "Unix Timestamp Prefixed",
+			value: "@1749988800",
+			want:  time.Unix(1749988800, 0),
+		},
+		{
+			name:  "RFC3339",
+			value: "2025-06-01T00:00:00Z",
+			want:  time.Date(2025, time.June, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "Relative",
+			value: "2 weeks ago",
+			want:  now.Add(-14 * 24 * time.Hour),
+		},
+		{
+			name:  "Relative Singular",
+			value: "1 day ago",
+			want:  now.Add(-24 * time.Hour),
+		},
+		{
+			name:  "Relative Dotted",
+			value: "2.weeks.ago",
+			want:  now.Add(-14 * 24 * time.Hour),
+		},
+		{
+			name:  "Yesterday",
+			value: "yesterday",
+			want:  now.Add(-24 * time.Hour),
+		},
+		{
+			name:  "Now",
+			value: "now",
+			want:  now,
+		},
+		{
+			name:    "Unsupported",
+			value:   "last tuesday",
+			wantErr: true,
+		},
+		{
+			name:    "Unsupported Unit",
+			value:   "2.fortnights.ago",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDate(tt.value, now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseDate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.True(t, tt.want.Equal(got), "parseDate() = %v, want %v", got, tt.want)
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package actions
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+
+	"github.com/act3-ai/gitoci/internal/git"
+	"github.com/act3-ai/gitoci/internal/model"
+	"github.com/act3-ai/gitoci/pkg/oci"
+)
+
+// Files kept in the private directory of the remote, see privateDir.
+const (
+	// marksFile is the marks file of fast-import and fast-export
+	marksFile = "git.marks"
+
+	// manifestFile records the digest of the manifest the private references
+	// were last updated from, see updatePrivateRefs
+	manifestFile = "manifest"
+)
+
+// privateNamespace returns the name identifying the remote in the local
+// repository. Remotes without a shortname are named by their URL, which is
+// not a valid reference name component, so a digest of it is used instead.
+func (action *GitOCI) privateNamespace() string {
+	ns := action.name
+	if ns == "" || strings.ContainsAny(ns, ":/") || plumbing.ReferenceName("refs/oci/"+ns).Validate() != nil {
+		sum := sha256.Sum256([]byte(action.name))
+		ns = hex.EncodeToString(sum[:8])
+	}
+	return ns
+}
+
+// privateRef maps a remote reference to its private reference in the local
+// repository, refs/oci/<remote>/...
+func (action *GitOCI) privateRef(name plumbing.ReferenceName) plumbing.ReferenceName {
+	return plumbing.ReferenceName(fmt.Sprintf("refs/oci/%s/%s", action.privateNamespace(), strings.TrimPrefix(name.String(), "refs/")))
+}
+
+// privateDir returns the directory holding the remote's helper state,
+// GIT_DIR/oci/<remote>.
+func (action *GitOCI) privateDir() string {
+	return filepath.Join(action.gitDir, "oci", action.privateNamespace())
+}
+
+// initMarks ensures the marks file exists, as Git requires it when importing
+// marks, returning its path.
+func (action *GitOCI) initMarks() (string, error) {
+	dir := action.privateDir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("creating helper directory: %w", err)
+	}
+
+	name := filepath.Join(dir, marksFile)
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_RDONLY, 0o644)
+	if err != nil {
+		return "", fmt.Errorf("creating marks file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("creating marks file: %w", err)
+	}
+	return name, nil
+}
+
+// updatePrivateRefs updates the private references of the remote to match
+// its config, recording the remote state as of the last fetch or push in the
+// local repository. References to objects that don't exist locally are
+// omitted, as are references no longer in the remote. The branch of the
+// remote HEAD is recorded as the symbolic reference refs/oci/<remote>/HEAD.
+//
+// The references are the targets of the refspec capability when importing,
+// keep the objects of the remote from being pruned by git gc, and are offered
+// by Git as haves when fetching. If every reference of the remote is
+// recorded, so is the digest of its manifest, letting list answer from the
+// private references while the manifest is unchanged, see privateConfig.
+func (action *GitOCI) updatePrivateRefs(ctx context.Context, local *filesystem.Storage, remote model.Modeler) error {
+	// the recorded manifest must not outlive the references it describes
+	if err := action.recordManifest(""); err != nil {
+		return err
+	}
+
+	cfg := remote.Config()
+	complete := true
+	want := make(map[plumbing.ReferenceName]plumbing.Hash, len(cfg.Heads)+len(cfg.Tags)+len(cfg.Refs))
+	for _, refs := range cfg.References() {
+		for name, info := range refs {
+			exists, err := git.HasObject(local, info.Commit)
+			switch {
+			case err != nil:
+				return err
+			case exists:
+				want[action.privateRef(name)] = info.Commit
+			default:
+				complete = false
+			}
+		}
+	}
+	var head *plumbing.Reference
+	if _, ok := want[action.privateRef(cfg.Head)]; ok && cfg.Head != "" {
+		head = plumbing.NewSymbolicReference(action.privateRef(plumbing.HEAD), action.privateRef(cfg.Head))
+	}
+
+	prefix := fmt.Sprintf("refs/oci/%s/", action.privateNamespace())
+	iter, err := local.IterReferences()
+	if err != nil {
+		return fmt.Errorf("resolving local references: %w", err)
+	}
+	var stale []plumbing.ReferenceName
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if !strings.HasPrefix(ref.Name().String(), prefix) {
+			return nil
+		}
+		if ref.Type() == plumbing.SymbolicReference {
+			if head == nil || head.Target() != ref.Target() {
+				stale = append(stale, ref.Name())
+			}
+			return nil
+		}
+		h, ok := want[ref.Name()]
+		switch {
+		case !ok:
+			stale = append(stale, ref.Name())
+		case h == ref.Hash():
+			delete(want, ref.Name())
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("resolving local references: %w", err)
+	}
+
+	for _, name := range stale {
+		slog.DebugContext(ctx, "removing private reference", "reference", name)
+		if err := local.RemoveReference(name); err != nil {
+			return fmt.Errorf("removing reference %s: %w", name, err)
+		}
+	}
+	for name, h := range want {
+		slog.DebugContext(ctx, "updating private reference", "reference", name, "object", h.String())
+		if err := local.SetReference(plumbing.NewHashReference(name, h)); err != nil {
+			return fmt.Errorf("updating reference %s: %w", name, err)
+		}
+	}
+	if head != nil {
+		if err := local.SetReference(head); err != nil {
+			return fmt.Errorf("updating reference %s: %w", head.Name(), err)
+		}
+	}
+
+	if !complete {
+		slog.DebugContext(ctx, "not recording remote manifest, private references are incomplete")
+		return nil
+	}
+	return action.recordManifest(remote.Manifest().Digest)
+}
+
+// recordManifest records the digest of the manifest the private references
+// were updated from, removing the record if dgst is empty. Nothing is recorded
+// outside of a repository.
+func (action *GitOCI) recordManifest(dgst digest.Digest) error {
+	if action.gitDir == "" {
+		return nil
+	}
+
+	name := filepath.Join(action.privateDir(), manifestFile)
+	if dgst == "" {
+		if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("removing recorded manifest: %w", err)
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(action.privateDir(), 0o755); err != nil {
+		return fmt.Errorf("creating helper directory: %w", err)
+	}
+	if err := os.WriteFile(name, []byte(dgst.String()+"\n"), 0o644); err != nil {
+		return fmt.Errorf("recording manifest: %w", err)
+	}
+	return nil
+}
+
+// privateConfig reconstructs the config of the remote from its private
+// references, if they record every reference of the manifest dgst. It returns
+// false if the references were recorded for another manifest, or not at all.
+// The layers of references are not recorded, so the config only serves to
+// list them.
+func (action *GitOCI) privateConfig(local *filesystem.Storage, dgst digest.Digest) (oci.ConfigGit, bool, error) {
+	if action.gitDir == "" {
+		return oci.ConfigGit{}, false, nil
+	}
+
+	b, err := os.ReadFile(filepath.Join(action.privateDir(), manifestFile))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return oci.ConfigGit{}, false, nil
+	case err != nil:
+		return oci.ConfigGit{}, false, fmt.Errorf("reading recorded manifest: %w", err)
+	case dgst == "" || strings.TrimSpace(string(b)) != dgst.String():
+		return oci.ConfigGit{}, false, nil
+	}
+
+	cfg := oci.ConfigGit{
+		ObjectFormat: git.SupportedFormat,
+		Heads:        make(map[plumbing.ReferenceName]oci.ReferenceInfo),
+		Tags:         make(map[plumbing.ReferenceName]oci.ReferenceInfo),
+		Refs:         make(map[plumbing.ReferenceName]oci.ReferenceInfo),
+	}
+	prefix := fmt.Sprintf("refs/oci/%s/", action.privateNamespace())
+	iter, err := local.IterReferences()
+	if err != nil {
+		return oci.ConfigGit{}, false, fmt.Errorf("resolving local references: %w", err)
+	}
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		rest, ok := strings.CutPrefix(ref.Name().String(), prefix)
+		if !ok {
+			return nil
+		}
+		if ref.Type() == plumbing.SymbolicReference {
+			cfg.Head = plumbing.ReferenceName("refs/" + strings.TrimPrefix(ref.Target().String(), prefix))
+			return nil
+		}
+
+		name := plumbing.ReferenceName("refs/" + rest)
+		info := oci.ReferenceInfo{Commit: ref.Hash()}
+		peeled, err := git.Peel(local, ref.Hash())
+		if err != nil {
+			return err
+		}
+		if peeled != ref.Hash() {
+			info.Peeled = peeled
+		}
+		switch {
+		case name.IsBranch():
+			cfg.Heads[name] = info
+		case name.IsTag():
+			cfg.Tags[name] = info
+		default:
+			cfg.Refs[name] = info
+		}
+		return nil
+	})
+	if err != nil {
+		return oci.ConfigGit{}, false, fmt.Errorf("resolving private references: %w", err)
+	}
+	return cfg, true, nil
+}
@@ -0,0 +1,126 @@
+package actions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"oras.land/oras-go/v2/content/memory"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/act3-ai/gitoci/internal/model"
+	"github.com/act3-ai/gitoci/pkg/oci"
+)
+
+func TestGitOCI_privateRef(t *testing.T) {
+	tests := []struct {
+		name   string
+		remote string
+		ref    plumbing.ReferenceName
+		want   plumbing.ReferenceName
+	}{
+		{
+			name:   "Shortname",
+			remote: "origin",
+			ref:    "refs/heads/main",
+			want:   "refs/oci/origin/heads/main",
+		},
+		{
+			name:   "Refspec Pattern",
+			remote: "origin",
+			ref:    "refs/tags/*",
+			want:   "refs/oci/origin/tags/*",
+		},
+		{
+			name:   "URL",
+			remote: "oci://127.0.0.1:5000/repo:v1",
+			ref:    "refs/heads/main",
+			want:   "refs/oci/df85e5bcbb00def8/heads/main",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action := &GitOCI{name: tt.remote}
+			assert.Equal(t, tt.want, action.privateRef(tt.ref))
+		})
+	}
+}
+
+func TestGitOCI_privateConfig(t *testing.T) {
+	ctx := context.Background()
+	action := &GitOCI{name: "origin", gitDir: t.TempDir(), local: newTestStorage()}
+	remote := model.NewModeler(memory.New())
+	if _, err := remote.Fetch(ctx, "v1"); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+
+	main := testCommit(t, action.local, "main")
+	tagObj := action.local.NewEncodedObject()
+	tag := &object.Tag{
+		Name:       "v1",
+		Tagger:     object.Signature{Name: "Test", Email: "test@example.com", When: time.Unix(1700000000, 0).UTC()},
+		Message:    "release",
+		TargetType: plumbing.CommitObject,
+		Target:     main,
+	}
+	if err := tag.Encode(tagObj); err != nil {
+		t.Fatalf("encoding tag: %v", err)
+	}
+	tagHash, err := action.local.SetEncodedObject(tagObj)
+	if err != nil {
+		t.Fatalf("storing tag: %v", err)
+	}
+	for name, info := range map[plumbing.ReferenceName]oci.ReferenceInfo{
+		"refs/heads/main":  {Commit: main},
+		"refs/heads/topic": {Commit: main},
+		"refs/tags/v1":     {Commit: tagHash, Peeled: main},
+		"refs/notes/ci":    {Commit: main},
+	} {
+		if err := remote.UpdateRef(name, info); err != nil {
+			t.Fatalf("UpdateRef() error = %v", err)
+		}
+	}
+	if err := remote.SetHead("refs/heads/topic"); err != nil {
+		t.Fatalf("SetHead() error = %v", err)
+	}
+	if _, err := remote.Push(ctx, "v1", nil); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+
+	if err := action.updatePrivateRefs(ctx, action.local, remote); err != nil {
+		t.Fatalf("updatePrivateRefs() error = %v", err)
+	}
+	cfg, ok, err := action.privateConfig(action.local, remote.Manifest().Digest)
+	if err != nil {
+		t.Fatalf("privateConfig() error = %v", err)
+	}
+	assert.True(t, ok, "private references not recorded")
+	assert.Equal(t, listRefs(remote.Config(), true), listRefs(cfg, true))
+
+	// another manifest was pushed since
+	_, ok, err = action.privateConfig(action.local, "sha256:0000000000000000000000000000000000000000000000000000000000000000")
+	if err != nil {
+		t.Fatalf("privateConfig() error = %v", err)
+	}
+	assert.False(t, ok, "private references of another manifest")
+
+	// the commit of a reference was not fetched
+	missing := testCommit(t, newTestStorage(), "missing")
+	if err := remote.UpdateRef("refs/heads/missing", oci.ReferenceInfo{Commit: missing}); err != nil {
+		t.Fatalf("UpdateRef() error = %v", err)
+	}
+	if _, err := remote.Push(ctx, "v1", nil); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	if err := action.updatePrivateRefs(ctx, action.local, remote); err != nil {
+		t.Fatalf("updatePrivateRefs() error = %v", err)
+	}
+	_, ok, err = action.privateConfig(action.local, remote.Manifest().Digest)
+	if err != nil {
+		t.Fatalf("privateConfig() error = %v", err)
+	}
+	assert.False(t, ok, "incomplete private references")
+}
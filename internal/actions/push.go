@@ -0,0 +1,622 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/sync/errgroup"
+	"oras.land/oras-go/v2/registry"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+
+	"github.com/act3-ai/gitoci/internal/cmd"
+	"github.com/act3-ai/gitoci/internal/git"
+	"github.com/act3-ai/gitoci/internal/model"
+	"github.com/act3-ai/gitoci/internal/progress"
+	"github.com/act3-ai/gitoci/pkg/oci"
+)
+
+// Reasons for rejecting a reference update, as understood by Git.
+//
+// See push_update_ref_status in Git's transport-helper.c.
+var (
+	errNonFastForward = errors.New("non-fast-forward")
+	errAlreadyExists  = errors.New("already exists")
+	errFetchFirst     = errors.New("fetch first")
+	errNeedsForce     = errors.New("needs force")
+	errStaleInfo      = errors.New("stale info")
+	errDeleteCurrent  = errors.New("deletion of the current branch prohibited")
+	errConcurrent     = errors.New("remote modified concurrently, fetch and try again")
+)
+
+// maxPushAttempts is the number of times a push is attempted when the remote
+// is modified concurrently.
+const maxPushAttempts = 5
+
+// refUpdate is a remote reference update requested by a push command.
+type refUpdate struct {
+	force bool
+	src   plumbing.ReferenceName
+	dst   plumbing.ReferenceName
+
+	// commit is the local object src resolves to
+	commit plumbing.Hash
+
+	// peeled is the object an annotated tag commit ultimately refers to,
+	// zero if commit is not a tag
+	peeled plumbing.Hash
+
+	// err is the reason the update was rejected, if any
+	err error
+}
+
+// deletes returns true if the update deletes its remote reference, i.e. it
+// has neither a local reference nor an object to update it to.
+func (u *refUpdate) deletes() bool {
+	return u.src == "" && u.commit.IsZero()
+}
+
+// parseRefspec parses the refspec of a push command, [+]<src>:<dst>. An
+// empty src deletes dst.
+func parseRefspec(refspec string) (*refUpdate, error) {
+	force := strings.HasPrefix(refspec, "+")
+	src, dst, ok := strings.Cut(strings.TrimPrefix(refspec, "+"), ":")
+	if !ok || dst == "" {
+		return nil, fmt.Errorf("invalid push refspec %s", refspec)
+	}
+
+	return &refUpdate{
+		force: force,
+		src:   plumbing.ReferenceName(src),
+		dst:   plumbing.ReferenceName(dst),
+	}, nil
+}
+
+// push handles a batch of 'push' commands.
+//
+// https://git-scm.com/docs/gitremote-helpers#Documentation/gitremote-helpers.txt-pushsrcdst
+func (action *GitOCI) push(ctx context.Context, cmds []cmd.Git) error {
+	slog.DebugContext(ctx, "handling push batch", "count", len(cmds))
+
+	remote, err := action.fetchRemote(ctx)
+	if err != nil {
+		return err
+	}
+
+	local, err := action.openLocal()
+	if err != nil {
+		return err
+	}
+
+	updates := make([]*refUpdate, 0, len(cmds))
+	for _, c := range cmds {
+		u, err := parseRefspec(c.Data[0])
+		if err != nil {
+			return err
+		}
+		updates = append(updates, u)
+	}
+
+	return action.pushUpdates(ctx, remote, local, updates)
+}
+
+// pushUpdates applies reference updates to the remote, writing the status of
+// each update to Git.
+func (action *GitOCI) pushUpdates(ctx context.Context, remote model.Modeler, local *filesystem.Storage, updates []*refUpdate) error {
+	for _, u := range updates {
+		u.err = resolveUpdate(local, u)
+	}
+	action.validateUpdates(local, remote.Config(), updates)
+
+	if err := action.updateRemote(ctx, remote, local, updates); err != nil {
+		return err
+	}
+	if !action.dryRun {
+		if err := action.updatePrivateRefs(ctx, local, remote); err != nil {
+			return err
+		}
+	}
+
+	lines := make([]string, 0, len(updates))
+	for _, u := range updates {
+		if u.err != nil {
+			slog.InfoContext(ctx, "rejected reference update", "reference", u.dst, "reason", u.err.Error())
+			lines = append(lines, fmt.Sprintf("error %s %s", u.dst, u.err))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("ok %s", u.dst))
+	}
+
+	if err := action.batcher.WriteBatch(lines...); err != nil {
+		return fmt.Errorf("writing push response: %w", err)
+	}
+
+	return nil
+}
+
+// resolveUpdate resolves the local object of a reference update, returning
+// the reason the update cannot be made. Updates with a known commit, e.g.
+// those received over the pack protocol, are not resolved, but are peeled.
+// Deletions have nothing to resolve.
+func resolveUpdate(local *filesystem.Storage, u *refUpdate) error {
+	if err := checkRefName(u.dst); err != nil {
+		return err
+	}
+	if u.deletes() {
+		return nil
+	}
+
+	if u.commit.IsZero() {
+		commit, err := git.ResolveRef(local, u.src)
+		if err != nil {
+			return err
+		}
+		u.commit = commit
+	}
+
+	peeled, err := git.Peel(local, u.commit)
+	if err != nil {
+		return err
+	}
+	if peeled != u.commit {
+		u.peeled = peeled
+	}
+
+	return nil
+}
+
+// validateUpdates rejects the reference updates that may not be applied to
+// the remote config. In an atomic push, all updates are rejected if any are.
+func (action *GitOCI) validateUpdates(local *filesystem.Storage, cfg oci.ConfigGit, updates []*refUpdate) {
+	for _, u := range updates {
+		if u.err == nil {
+			u.err = action.checkLease(cfg, u)
+		}
+		if u.err == nil {
+			u.err = validateUpdate(local, cfg, u)
+		}
+	}
+
+	if action.atomic {
+		rejectAtomic(updates)
+	}
+}
+
+// rejectAtomic rejects all reference updates with the same error if any
+// update was rejected.
+func rejectAtomic(updates []*refUpdate) {
+	idx := slices.IndexFunc(updates, func(u *refUpdate) bool {
+		return u.err != nil
+	})
+	if idx < 0 {
+		return
+	}
+
+	err := fmt.Errorf("atomic push failed, %s rejected: %w", updates[idx].dst, updates[idx].err)
+	for _, u := range updates {
+		u.err = err
+	}
+}
+
+// checkLease ensures the remote reference of an update has the value expected
+// by an 'option cas' command, if any. Leases are checked even if the update is
+// forced.
+func (action *GitOCI) checkLease(cfg oci.ConfigGit, u *refUpdate) error {
+	expected, ok := action.cas[u.dst]
+	if !ok {
+		return nil
+	}
+
+	// zero if the reference does not exist
+	current, _ := cfg.Reference(u.dst)
+	if current.Commit != expected {
+		return errStaleInfo
+	}
+	return nil
+}
+
+// validateUpdate ensures a reference update does not discard remote history,
+// unless forced. Existing tags may not be moved, all other references must
+// fast-forward. Any reference may be deleted, except the branch of the remote
+// HEAD, which clients would fail to check out.
+func validateUpdate(local *filesystem.Storage, cfg oci.ConfigGit, u *refUpdate) error {
+	if u.deletes() {
+		if !u.force && u.dst == remoteHead(cfg) {
+			return errDeleteCurrent
+		}
+		return nil
+	}
+	if u.force {
+		return nil
+	}
+
+	info, ok := cfg.Reference(u.dst)
+	switch {
+	case !ok || info.Commit == u.commit:
+		return nil
+	case u.dst.IsTag():
+		return errAlreadyExists
+	}
+
+	// we cannot evaluate history we don't have
+	exists, err := git.HasObject(local, info.Commit)
+	switch {
+	case err != nil:
+		return err
+	case !exists:
+		return errFetchFirst
+	}
+
+	// only commits have history to fast-forward, e.g. replace references
+	// may point to any object
+	for _, h := range []plumbing.Hash{info.Commit, u.commit} {
+		commit, err := git.IsCommit(local, h)
+		switch {
+		case err != nil:
+			return err
+		case !commit:
+			return errNeedsForce
+		}
+	}
+
+	ff, err := git.IsAncestor(local, info.Commit, u.commit)
+	switch {
+	case err != nil:
+		return err
+	case !ff:
+		return errNonFastForward
+	}
+
+	return nil
+}
+
+// checkRefName returns the reason a reference may not be stored in a remote,
+// if any. Remote-tracking references, including the private references of
+// this helper, describe the state of other repositories.
+func checkRefName(name plumbing.ReferenceName) error {
+	switch {
+	case !strings.HasPrefix(name.String(), "refs/"):
+		return fmt.Errorf("unsupported reference %s, expected a name beginning with refs/", name)
+	case name.IsRemote(), strings.HasPrefix(name.String(), "refs/oci/"):
+		return fmt.Errorf("refusing to store remote-tracking reference %s", name)
+	}
+	return nil
+}
+
+// updateRemote pushes a packfile layer containing the objects needed by the
+// accepted reference updates, followed by the updated config and manifest,
+// see publishUpdates.
+func (action *GitOCI) updateRemote(ctx context.Context, remote model.Modeler, local *filesystem.Storage, updates []*refUpdate) error {
+	var layer ocispec.Descriptor
+	if want := acceptedCommits(updates); len(want) > 0 {
+		var err error
+		layer, err = action.pushPack(ctx, remote, local, want, remoteCommits(remote.Config()))
+		if err != nil {
+			return err
+		}
+	}
+	return action.publishUpdates(ctx, remote, local, updates, layer)
+}
+
+// publishUpdates adds a pushed packfile layer and the accepted reference
+// updates to the remote, pushing its config and manifest. If the remote is
+// modified concurrently, the updates are validated against the new remote
+// config and retried.
+func (action *GitOCI) publishUpdates(ctx context.Context, remote model.Modeler, local *filesystem.Storage, updates []*refUpdate, layer ocispec.Descriptor) error {
+	if !anyAccepted(updates) {
+		slog.DebugContext(ctx, "no reference updates accepted, skipping remote update")
+		return nil
+	}
+
+	ref, err := parseAddress(action.addess)
+	if err != nil {
+		return err
+	}
+
+	annotations := map[string]string{
+		oci.AnnotationGitRemoteOCIVersion: action.version,
+	}
+	desc, err := action.pushManifest(ctx, remote, ref, annotations, func(attempt int) (bool, error) {
+		if attempt > 1 {
+			// rebase our updates onto the new remote config, our layer only
+			// contains objects the new remote may not have
+			action.validateUpdates(local, remote.Config(), updates)
+			if !anyAccepted(updates) {
+				slog.InfoContext(ctx, "all reference updates conflict with remote, skipping remote update")
+				return false, nil
+			}
+		}
+		applyUpdates(remote, layer, updates)
+		return true, initHead(ctx, local, remote)
+	})
+	switch {
+	case errors.Is(err, errConcurrent):
+		for _, u := range updates {
+			if u.err == nil {
+				u.err = errConcurrent
+			}
+		}
+		return nil
+	case err != nil:
+		return err
+	case desc.Digest != "":
+		slog.InfoContext(ctx, "updated remote", "reference", ref.String(), "digest", desc.Digest)
+	}
+	return nil
+}
+
+// pushManifest pushes the config and manifest of the remote, retrying when
+// the remote is modified concurrently. Before each attempt, apply modifies the
+// remote model, refetched for every retry, returning false if there is
+// nothing left to push. errConcurrent is returned once maxPushAttempts are
+// exhausted. Nothing is pushed in a dry run, nor if apply returns false, in
+// which case an empty descriptor is returned.
+func (action *GitOCI) pushManifest(ctx context.Context, remote model.Modeler, ref registry.Reference, annotations map[string]string, apply func(attempt int) (bool, error)) (ocispec.Descriptor, error) {
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			slog.InfoContext(ctx, "remote modified concurrently, retrying push", "reference", ref.String(), "attempt", attempt)
+			if _, err := remote.Fetch(ctx, ref.Reference); err != nil {
+				return ocispec.Descriptor{}, fmt.Errorf("refetching remote %s: %w", ref.String(), err)
+			}
+		}
+
+		ok, err := apply(attempt)
+		if err != nil || !ok {
+			return ocispec.Descriptor{}, err
+		}
+		if action.dryRun {
+			slog.InfoContext(ctx, "dry run, skipping remote update", "reference", ref.String())
+			return ocispec.Descriptor{}, nil
+		}
+
+		desc, err := remote.Push(ctx, ref.Reference, annotations)
+		switch {
+		case err == nil:
+			return desc, nil
+		case !errors.Is(err, model.ErrConflict):
+			return ocispec.Descriptor{}, fmt.Errorf("updating remote %s: %w", ref.String(), err)
+		case attempt >= maxPushAttempts:
+			slog.ErrorContext(ctx, "exceeded maximum push attempts", "reference", ref.String(), "attempts", attempt)
+			return ocispec.Descriptor{}, fmt.Errorf("updating remote %s: %w", ref.String(), errConcurrent)
+		}
+	}
+}
+
+// remoteCommits returns the objects the references of the remote point to,
+// the objects reachable from them are already in a layer.
+func remoteCommits(cfg oci.ConfigGit) []plumbing.Hash {
+	commits := make([]plumbing.Hash, 0, len(cfg.Heads)+len(cfg.Tags)+len(cfg.Refs))
+	for _, refs := range cfg.References() {
+		for _, info := range refs {
+			commits = append(commits, info.Commit)
+		}
+	}
+	return commits
+}
+
+// anyAccepted returns true if any reference update was accepted.
+func anyAccepted(updates []*refUpdate) bool {
+	return slices.ContainsFunc(updates, func(u *refUpdate) bool {
+		return u.err == nil
+	})
+}
+
+// acceptedCommits returns the local commits of the accepted reference updates,
+// excluding deletions.
+func acceptedCommits(updates []*refUpdate) []plumbing.Hash {
+	commits := make([]plumbing.Hash, 0, len(updates))
+	for _, u := range updates {
+		if u.err == nil && !u.deletes() {
+			commits = append(commits, u.commit)
+		}
+	}
+	return commits
+}
+
+// applyUpdates adds a pushed packfile layer and the accepted reference updates
+// to the remote model. An empty layer indicates no objects were pushed.
+// Deleted references leave their objects in the layers, see GC.
+func applyUpdates(remote model.Modeler, layer ocispec.Descriptor, updates []*refUpdate) {
+	if layer.Digest != "" {
+		remote.AddLayers(layer)
+	}
+
+	for _, u := range updates {
+		switch {
+		case u.err != nil:
+			continue
+		case u.deletes():
+			remote.RemoveRef(u.dst)
+			continue
+		}
+
+		info := oci.ReferenceInfo{
+			Commit: u.commit,
+			Peeled: u.peeled,
+			Layer:  layer.Digest,
+		}
+		if layer.Digest == "" {
+			info.Layer = existingLayer(remote, u.commit)
+		}
+
+		if err := remote.UpdateRef(u.dst, info); err != nil {
+			u.err = err
+		}
+	}
+}
+
+// initHead records the remote HEAD if the remote does not have one, preferring
+// the branch of the local HEAD.
+func initHead(ctx context.Context, local *filesystem.Storage, remote model.Modeler) error {
+	cfg := remote.Config()
+	if cfg.Head != "" {
+		return nil
+	}
+
+	head := remoteHead(cfg)
+	ref, err := local.Reference(plumbing.HEAD)
+	switch {
+	case errors.Is(err, plumbing.ErrReferenceNotFound):
+	case err != nil:
+		return fmt.Errorf("resolving local HEAD: %w", err)
+	case ref.Type() == plumbing.SymbolicReference:
+		if _, ok := cfg.Heads[ref.Target()]; ok {
+			head = ref.Target()
+		}
+	}
+	if head == "" {
+		return nil
+	}
+
+	slog.DebugContext(ctx, "initializing remote HEAD", "head", head)
+	return remote.SetHead(head)
+}
+
+// pushPack pushes a packfile layer containing the objects reachable from want,
+// excluding those reachable from have. An empty descriptor is returned if no
+// objects need to be pushed. The packfile is built, but not pushed, in a dry run.
+func (action *GitOCI) pushPack(ctx context.Context, remote model.Modeler, local *filesystem.Storage, want, have []plumbing.Hash) (ocispec.Descriptor, error) {
+	objs, err := git.ListObjects(local, want, have)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	if len(objs) == 0 {
+		slog.DebugContext(ctx, "remote has all objects, skipping packfile layer")
+		return ocispec.Descriptor{}, nil
+	}
+
+	tips := make([]string, 0, len(want))
+	for _, h := range want {
+		tips = append(tips, h.String())
+	}
+
+	meter := action.meter("Writing layers", 1)
+	layer, err := action.pushLayer(ctx, remote, packObjects(ctx, action.gitDir, local, objs), objs, tips, meter)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	meter.Finish()
+	slog.DebugContext(ctx, "pushed packfile layer", "layer", layer.Digest, "size", layer.Size, "objects", len(objs))
+
+	return layer, nil
+}
+
+// pushLayer streams the packfile written by pack to the remote as a layer
+// annotated with the tips it was created for, while it is being written. The
+// objects of the packfile identify its upload so it can be resumed, nil if it
+// can't be written again. The packfile is built, but not pushed, in a dry run.
+func (action *GitOCI) pushLayer(ctx context.Context, remote model.Modeler, pack func(w io.Writer) error, objs []plumbing.Hash, tips []string, meter *progress.Meter) (ocispec.Descriptor, error) {
+	push := remote.PushLayerStream
+	switch {
+	case action.dryRun:
+		push = describeLayer
+	case action.chunkSize > 0:
+		push = action.chunkedPush(remote, objs)
+	}
+
+	desc, err := streamLayer(ctx, push, meter, pack)
+	if errors.Is(err, model.ErrUploadChanged) {
+		slog.WarnContext(ctx, "packfile layer differs from interrupted upload, uploading it again")
+		desc, err = streamLayer(ctx, push, meter, pack)
+	}
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	meter.LayerDone()
+
+	// layers of only trees and blobs, repacked by gc, have no tips
+	if len(tips) > 0 {
+		desc.Annotations = map[string]string{
+			oci.AnnotationGitPackTips: strings.Join(tips, ","),
+		}
+	}
+	if action.dryRun {
+		slog.InfoContext(ctx, "dry run, skipping packfile layer push", "layer", desc.Digest, "size", desc.Size)
+	}
+	return desc, nil
+}
+
+// packObjects returns a function writing a packfile of objs, read from st.
+// Repositories on disk, at gitDir, are packed by git pack-objects, which
+// streams objects rather than holding them in memory. Others, e.g. in memory,
+// are packed by go-git.
+func packObjects(ctx context.Context, gitDir string, st storer.EncodedObjectStorer, objs []plumbing.Hash) func(w io.Writer) error {
+	if gitDir == "" {
+		return func(w io.Writer) error {
+			return git.EncodePack(w, st, objs)
+		}
+	}
+	return func(w io.Writer) error {
+		return git.WritePack(ctx, w, gitDir, objs)
+	}
+}
+
+// streamLayer pushes the packfile written by pack as it is written.
+func streamLayer(ctx context.Context, push func(context.Context, io.Reader) (ocispec.Descriptor, error), meter *progress.Meter, pack func(w io.Writer) error) (ocispec.Descriptor, error) {
+	var desc ocispec.Descriptor
+	pr, pw := io.Pipe()
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		err := pack(pw)
+		pw.CloseWithError(err)
+		return err
+	})
+	counted := meter.Reader(pr)
+	g.Go(func() error {
+		var err error
+		desc, err = push(gctx, counted)
+		// stops pack if the push failed
+		pr.CloseWithError(err)
+		return err
+	})
+	if err := g.Wait(); err != nil {
+		// the layer may be pushed again
+		meter.Discard(counted)
+		return ocispec.Descriptor{}, err //nolint:wrapcheck
+	}
+	return desc, nil
+}
+
+// describeLayer returns the descriptor of a packfile layer read from r,
+// without pushing it.
+func describeLayer(_ context.Context, r io.Reader) (ocispec.Descriptor, error) {
+	digester := digest.Canonical.Digester()
+	n, err := io.Copy(digester.Hash(), r)
+	if err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("reading packfile layer: %w", err)
+	}
+	return ocispec.Descriptor{
+		MediaType: oci.MediaTypePackLayer,
+		Digest:    digester.Digest(),
+		Size:      n,
+	}, nil
+}
+
+// existingLayer returns the layer containing a commit already in the remote,
+// falling back to the newest layer as all layers before it are required to
+// reconstruct its history.
+func existingLayer(remote model.Modeler, commit plumbing.Hash) digest.Digest {
+	cfg := remote.Config()
+	for _, refs := range cfg.References() {
+		for _, info := range refs {
+			if info.Commit == commit {
+				return info.Layer
+			}
+		}
+	}
+
+	layers := remote.Layers()
+	if len(layers) == 0 {
+		return ""
+	}
+	return layers[len(layers)-1].Digest
+}
@@ -0,0 +1,308 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/act3-ai/gitoci/internal/cmd"
+	"github.com/act3-ai/gitoci/internal/model"
+	"github.com/act3-ai/gitoci/pkg/oci"
+)
+
+func Test_checkRefName(t *testing.T) {
+	tests := []struct {
+		name    string
+		ref     plumbing.ReferenceName
+		wantErr bool
+	}{
+		{name: "Head", ref: "refs/heads/main"},
+		{name: "Tag", ref: "refs/tags/v1"},
+		{name: "Notes", ref: "refs/notes/commits"},
+		{name: "Replace", ref: "refs/replace/0fb2d5336295928c256f40ff2621d4312093dab3"},
+		{name: "Pull Request", ref: "refs/pull/1/head"},
+		{name: "Remote-Tracking", ref: "refs/remotes/origin/main", wantErr: true},
+		{name: "Private", ref: "refs/oci/origin/heads/main", wantErr: true},
+		{name: "Not A Reference", ref: "HEAD", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkRefName(tt.ref); (err != nil) != tt.wantErr {
+				t.Errorf("checkRefName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validateUpdate_deletion(t *testing.T) {
+	commit := plumbing.NewHash("2f5bc3b4ea8aa6a1e0ef4c3d9fdf3ea1a3a1e2c4")
+	cfg := oci.ConfigGit{
+		Head: "refs/heads/main",
+		Heads: map[plumbing.ReferenceName]oci.ReferenceInfo{
+			"refs/heads/main":  {Commit: commit},
+			"refs/heads/topic": {Commit: commit},
+		},
+		Tags: map[plumbing.ReferenceName]oci.ReferenceInfo{
+			"refs/tags/v1": {Commit: commit},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		update  *refUpdate
+		wantErr error
+	}{
+		{name: "Branch", update: &refUpdate{dst: "refs/heads/topic"}},
+		{name: "Tag", update: &refUpdate{dst: "refs/tags/v1"}},
+		{name: "Nonexistent", update: &refUpdate{dst: "refs/heads/gone"}},
+		{name: "Current Branch", update: &refUpdate{dst: "refs/heads/main"}, wantErr: errDeleteCurrent},
+		{name: "Current Branch Forced", update: &refUpdate{force: true, dst: "refs/heads/main"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// deletions don't consult the local repository
+			err := validateUpdate(nil, cfg, tt.update)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("validateUpdate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validateUpdate(t *testing.T) {
+	local := newTestStorage()
+	base := testCommit(t, local, "base")
+	next := testCommit(t, local, "next", base)
+	ahead := testCommit(t, local, "ahead", next)
+	diverged := testCommit(t, local, "diverged", base)
+	unknown := testCommit(t, newTestStorage(), "unknown")
+
+	blobObj := local.NewEncodedObject()
+	blobObj.SetType(plumbing.BlobObject)
+	blob, err := local.SetEncodedObject(blobObj)
+	if err != nil {
+		t.Fatalf("storing blob: %v", err)
+	}
+
+	cfg := oci.ConfigGit{
+		Heads: map[plumbing.ReferenceName]oci.ReferenceInfo{
+			"refs/heads/main":    {Commit: next},
+			"refs/heads/fetched": {Commit: unknown},
+		},
+		Tags: map[plumbing.ReferenceName]oci.ReferenceInfo{
+			"refs/tags/v1": {Commit: base},
+		},
+		Refs: map[plumbing.ReferenceName]oci.ReferenceInfo{
+			"refs/replace/" + plumbing.ReferenceName(base.String()): {Commit: blob},
+		},
+	}
+	replace := "refs/replace/" + plumbing.ReferenceName(base.String())
+
+	tests := []struct {
+		name    string
+		update  *refUpdate
+		wantErr error
+	}{
+		{name: "New Branch", update: &refUpdate{dst: "refs/heads/topic", commit: next}},
+		{name: "New Tag", update: &refUpdate{dst: "refs/tags/v2", commit: next}},
+		{name: "Unchanged", update: &refUpdate{dst: "refs/heads/main", commit: next}},
+		{name: "Fast-Forward", update: &refUpdate{dst: "refs/heads/main", commit: ahead}},
+		{name: "Non-Fast-Forward", update: &refUpdate{dst: "refs/heads/main", commit: diverged}, wantErr: errNonFastForward},
+		{name: "Non-Fast-Forward Forced", update: &refUpdate{force: true, dst: "refs/heads/main", commit: diverged}},
+		{name: "Rewind", update: &refUpdate{dst: "refs/heads/main", commit: base}, wantErr: errNonFastForward},
+		{name: "Tag Moved", update: &refUpdate{dst: "refs/tags/v1", commit: next}, wantErr: errAlreadyExists},
+		{name: "Tag Moved Forced", update: &refUpdate{force: true, dst: "refs/tags/v1", commit: next}},
+		{name: "Remote Commit Missing", update: &refUpdate{dst: "refs/heads/fetched", commit: next}, wantErr: errFetchFirst},
+		{name: "Not A Commit", update: &refUpdate{dst: replace, commit: next}, wantErr: errNeedsForce},
+		{name: "Not A Commit Forced", update: &refUpdate{force: true, dst: replace, commit: next}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateUpdate(local, cfg, tt.update)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("validateUpdate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGitOCI_checkLease(t *testing.T) {
+	current := plumbing.ComputeHash(plumbing.CommitObject, []byte("current"))
+	other := plumbing.ComputeHash(plumbing.CommitObject, []byte("other"))
+	cfg := oci.ConfigGit{
+		Heads: map[plumbing.ReferenceName]oci.ReferenceInfo{
+			"refs/heads/main": {Commit: current},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		lease   string // option cas value, none if empty
+		update  *refUpdate
+		wantErr error
+	}{
+		{name: "No Lease", update: &refUpdate{dst: "refs/heads/main", commit: other}},
+		{name: "Lease Holds", lease: "refs/heads/main:" + current.String(), update: &refUpdate{dst: "refs/heads/main", commit: other}},
+		{name: "Lease Broken", lease: "refs/heads/main:" + other.String(), update: &refUpdate{dst: "refs/heads/main", commit: other}, wantErr: errStaleInfo},
+		{name: "Lease Broken Forced", lease: "refs/heads/main:" + other.String(), update: &refUpdate{force: true, dst: "refs/heads/main", commit: other}, wantErr: errStaleInfo},
+		{name: "Lease On Other Reference", lease: "refs/heads/topic:" + other.String(), update: &refUpdate{dst: "refs/heads/main", commit: other}},
+		{name: "Must Not Exist Holds", lease: "refs/heads/topic:" + plumbing.ZeroHash.String(), update: &refUpdate{dst: "refs/heads/topic", commit: other}},
+		{name: "Must Not Exist Broken", lease: "refs/heads/main:" + plumbing.ZeroHash.String(), update: &refUpdate{dst: "refs/heads/main", commit: other}, wantErr: errStaleInfo},
+		{name: "Deleted Concurrently", lease: "refs/heads/topic:" + current.String(), update: &refUpdate{dst: "refs/heads/topic", commit: other}, wantErr: errStaleInfo},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action := &GitOCI{}
+			if tt.lease != "" {
+				if err := action.compareAndSwap(tt.lease); err != nil {
+					t.Fatalf("compareAndSwap() error = %v", err)
+				}
+			}
+			err := action.checkLease(cfg, tt.update)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("checkLease() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// recordingModeler counts the manifests and layers pushed to a Modeler.
+type recordingModeler struct {
+	model.Modeler
+
+	pushes int
+	layers int
+}
+
+// Push implements model.Modeler.
+func (m *recordingModeler) Push(ctx context.Context, ref string, annotations map[string]string) (ocispec.Descriptor, error) {
+	m.pushes++
+	return m.Modeler.Push(ctx, ref, annotations) //nolint:wrapcheck
+}
+
+// PushLayer implements model.Modeler.
+func (m *recordingModeler) PushLayer(ctx context.Context, desc ocispec.Descriptor, r io.Reader) error {
+	m.layers++
+	return m.Modeler.PushLayer(ctx, desc, r) //nolint:wrapcheck
+}
+
+// PushLayerStream implements model.Modeler.
+func (m *recordingModeler) PushLayerStream(ctx context.Context, r io.Reader) (ocispec.Descriptor, error) {
+	m.layers++
+	return m.Modeler.PushLayerStream(ctx, r) //nolint:wrapcheck
+}
+
+// PushLayerChunked implements model.Modeler.
+func (m *recordingModeler) PushLayerChunked(ctx context.Context, r io.Reader, opts model.ChunkedUpload) (ocispec.Descriptor, error) {
+	m.layers++
+	return m.Modeler.PushLayerChunked(ctx, r, opts) //nolint:wrapcheck
+}
+
+// newPushAction returns an action pushing to a recording in-memory remote,
+// with the local branch main one commit ahead of the remote branch and tag.
+func newPushAction(t *testing.T) (*GitOCI, *recordingModeler, *bytes.Buffer) {
+	t.Helper()
+
+	action, _ := newTestAction(t, strings.NewReader(""))
+	var out bytes.Buffer
+	action.batcher = cmd.NewBatcher(strings.NewReader(""), &out)
+
+	base := testCommit(t, action.local, "base")
+	next := testCommit(t, action.local, "next", base)
+	if err := action.local.SetReference(plumbing.NewHashReference("refs/heads/main", next)); err != nil {
+		t.Fatalf("SetReference() error = %v", err)
+	}
+
+	for _, name := range []plumbing.ReferenceName{"refs/heads/main", "refs/tags/v1"} {
+		if err := action.remote.UpdateRef(name, oci.ReferenceInfo{Commit: base}); err != nil {
+			t.Fatalf("UpdateRef() error = %v", err)
+		}
+	}
+	remote := &recordingModeler{Modeler: action.remote}
+	action.remote = remote
+	return action, remote, &out
+}
+
+// parseRefspecs parses the refspecs of push commands.
+func parseRefspecs(t *testing.T, refspecs ...string) []*refUpdate {
+	t.Helper()
+
+	updates := make([]*refUpdate, 0, len(refspecs))
+	for _, refspec := range refspecs {
+		u, err := parseRefspec(refspec)
+		if err != nil {
+			t.Fatalf("parseRefspec() error = %v", err)
+		}
+		updates = append(updates, u)
+	}
+	return updates
+}
+
+func TestGitOCI_pushUpdates_atomic(t *testing.T) {
+	tests := []struct {
+		name       string
+		atomic     bool
+		want       string
+		wantPushes int
+	}{
+		{
+			name:       "Not Atomic",
+			want:       "ok refs/heads/main\nerror refs/tags/v1 already exists\n\n",
+			wantPushes: 1,
+		},
+		{
+			name:   "Atomic",
+			atomic: true,
+			want: "error refs/heads/main atomic push failed, refs/tags/v1 rejected: already exists\n" +
+				"error refs/tags/v1 atomic push failed, refs/tags/v1 rejected: already exists\n\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, remote, out := newPushAction(t)
+			action.atomic = tt.atomic
+			before := remote.Config().Heads["refs/heads/main"]
+
+			// moving the tag is rejected
+			updates := parseRefspecs(t, "refs/heads/main:refs/heads/main", "refs/heads/main:refs/tags/v1")
+			if err := action.pushUpdates(context.Background(), remote, action.local, updates); err != nil {
+				t.Fatalf("pushUpdates() error = %v", err)
+			}
+			assert.Equal(t, tt.want, out.String())
+			assert.Equal(t, tt.wantPushes, remote.pushes)
+			assert.Equal(t, tt.wantPushes, remote.layers)
+			if tt.atomic {
+				assert.Equal(t, before, remote.Config().Heads["refs/heads/main"])
+			}
+		})
+	}
+}
+
+func TestGitOCI_pushUpdates_dryRun(t *testing.T) {
+	ctx := context.Background()
+	action, remote, out := newPushAction(t)
+
+	c := cmd.Git{Cmd: cmd.Option, SubCmd: cmd.OptionDryRun, Data: []string{"true"}}
+	if err := action.option(ctx, c); err != nil {
+		t.Fatalf("option() error = %v", err)
+	}
+	assert.Equal(t, "ok\n", out.String())
+	out.Reset()
+
+	updates := parseRefspecs(t, "refs/heads/main:refs/heads/main", "refs/heads/main:refs/heads/topic")
+	if err := action.pushUpdates(ctx, remote, action.local, updates); err != nil {
+		t.Fatalf("pushUpdates() error = %v", err)
+	}
+	assert.Equal(t, "ok refs/heads/main\nok refs/heads/topic\n\n", out.String())
+	assert.Zero(t, remote.pushes, "manifest pushed in a dry run")
+	assert.Zero(t, remote.layers, "layer pushed in a dry run")
+	assert.False(t, remote.Exists())
+}
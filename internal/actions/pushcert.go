@@ -0,0 +1,140 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+
+	"github.com/act3-ai/gitoci/internal/model"
+)
+
+// Push certificate lines.
+//
+// https://git-scm.com/docs/pack-protocol#_push_certificate
+const (
+	certNoncePrefix = "nonce "
+	certSigPrefix   = "-----BEGIN "
+	certEnd         = "push-cert-end\n"
+)
+
+// pushCertNonce generates the nonce a push certificate must include, binding
+// it to the push it was created for.
+func pushCertNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating push certificate nonce: %w", err)
+	}
+	return fmt.Sprintf("%d-%s", time.Now().Unix(), hex.EncodeToString(b)), nil
+}
+
+// readPushCert reads a push certificate following its 'push-cert' line, up to
+// and excluding 'push-cert-end', returning the certificate and the reference
+// update commands it contains.
+func readPushCert(scanner *pktline.Scanner) ([]byte, []string, error) {
+	var cert bytes.Buffer
+	var commands []string
+	header, signature := true, false
+	for scanner.Scan() {
+		line := string(scanner.Bytes())
+		if line == certEnd {
+			return cert.Bytes(), commands, nil
+		}
+		cert.WriteString(line)
+
+		switch {
+		case header:
+			// a blank line separates the header from the commands
+			header = line != "\n"
+		case strings.HasPrefix(line, certSigPrefix):
+			signature = true
+		case !signature:
+			commands = append(commands, strings.TrimSuffix(line, "\n"))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("reading push certificate: %w", err)
+	}
+	return nil, nil, errors.New("connection closed by Git before push certificate ended")
+}
+
+// certNonce returns the nonce of a push certificate, or an empty string if it
+// has none.
+func certNonce(cert []byte) string {
+	for _, line := range strings.Split(string(cert), "\n") {
+		if line == "" {
+			// end of header
+			break
+		}
+		if nonce, ok := strings.CutPrefix(line, certNoncePrefix); ok {
+			return nonce
+		}
+	}
+	return ""
+}
+
+// storePushCert attaches the push certificate received with a push, if any,
+// to the pushed manifest. Nothing is stored if the remote wasn't updated.
+func (action *GitOCI) storePushCert(ctx context.Context, remote model.Modeler, updates []*refUpdate) error {
+	if action.pushCert == nil || action.dryRun || !anyAccepted(updates) {
+		return nil
+	}
+
+	desc, err := remote.PushCert(ctx, action.pushCert)
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "stored push certificate", "digest", desc.Digest)
+	return nil
+}
+
+// setPushCert handles the 'option pushcert' command, sent before push
+// commands. Git signs pushes itself when connected, see receivePack, but
+// certificates can't be created for push commands.
+//
+// https://git-scm.com/docs/gitremote-helpers#Documentation/gitremote-helpers.txt-optionpushcerttruefalse
+func (action *GitOCI) setPushCert(value string) error {
+	switch value {
+	case "false", "if-asked":
+		return nil
+	case "true":
+		return errors.New("signed pushes require the connect capability")
+	default:
+		return fmt.Errorf("invalid pushcert value %s, expected true, false, or if-asked", value)
+	}
+}
+
+// PushCerts writes the push certificates referring to the current manifest of
+// the remote, i.e. those of the most recent push if it was signed, separated
+// by blank lines. Unlike the other actions it is not driven by Git.
+func (action *GitOCI) PushCerts(ctx context.Context) error {
+	remote, err := action.fetchRemote(ctx)
+	if err != nil {
+		return err
+	}
+
+	certs, err := remote.PushCerts(ctx)
+	if err != nil {
+		return err
+	}
+	if len(certs) == 0 {
+		return errors.New("remote manifest has no push certificates")
+	}
+
+	for i, cert := range certs {
+		if i > 0 {
+			cert = append([]byte("\n"), cert...)
+		}
+		if _, err := action.out.Write(cert); err != nil {
+			return fmt.Errorf("writing push certificate: %w", err)
+		}
+	}
+	return nil
+}
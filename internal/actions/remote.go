@@ -0,0 +1,107 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"oras.land/oras-go/v2/registry"
+	"oras.land/oras-go/v2/registry/remote"
+	"oras.land/oras-go/v2/registry/remote/auth"
+	"oras.land/oras-go/v2/registry/remote/credentials"
+	"oras.land/oras-go/v2/registry/remote/retry"
+
+	"github.com/act3-ai/gitoci/internal/model"
+)
+
+// schemeOCI is the URL scheme Git uses to invoke git-remote-oci.
+const schemeOCI = "oci://"
+
+// parseAddress parses the OCI reference of a remote address, e.g.
+// oci://registry.example.com/repo:tag.
+func parseAddress(address string) (registry.Reference, error) {
+	ref, err := registry.ParseReference(strings.TrimPrefix(address, schemeOCI))
+	if err != nil {
+		return registry.Reference{}, fmt.Errorf("parsing remote address %s: %w", address, err)
+	}
+	if err := ref.ValidateReferenceAsTag(); err != nil {
+		return registry.Reference{}, fmt.Errorf("remote address %s must include a tag: %w", address, err)
+	}
+	return ref, nil
+}
+
+// newRepository initializes a remote OCI repository, using the credentials
+// stored in the docker config.
+func newRepository(ref registry.Reference, version string) (*remote.Repository, error) {
+	repo, err := remote.NewRepository(ref.String())
+	if err != nil {
+		return nil, fmt.Errorf("initializing remote repository: %w", err)
+	}
+
+	store, err := credentials.NewStoreFromDocker(credentials.StoreOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("initializing credential store: %w", err)
+	}
+
+	client := &auth.Client{
+		Client:     retry.DefaultClient,
+		Cache:      auth.NewCache(),
+		Credential: credentials.Credential(store),
+	}
+	client.SetUserAgent("git-remote-oci/" + version)
+	repo.Client = client
+
+	// local registries are rarely served over HTTPS
+	host := ref.Host()
+	repo.PlainHTTP = strings.HasPrefix(host, "localhost:") || strings.HasPrefix(host, "127.0.0.1:")
+
+	return repo, nil
+}
+
+// fetchRemote returns the model of the OCI remote, fetching the manifest and
+// config on first use.
+func (action *GitOCI) fetchRemote(ctx context.Context) (model.Modeler, error) {
+	if action.remote != nil {
+		return action.remote, nil
+	}
+
+	ref, err := parseAddress(action.addess)
+	if err != nil {
+		return nil, err
+	}
+	modeler, err := action.newModeler(ref)
+	if err != nil {
+		return nil, err
+	}
+	if err := action.loadRemote(ctx, ref, modeler); err != nil {
+		return nil, err
+	}
+	return modeler, nil
+}
+
+// loadRemote fetches the manifest and config of the OCI remote at ref into
+// modeler, which becomes the model of the remote.
+func (action *GitOCI) loadRemote(ctx context.Context, ref registry.Reference, modeler model.Modeler) error {
+	slog.DebugContext(ctx, "fetching remote model", "reference", ref.String())
+	if _, err := modeler.Fetch(ctx, ref.Reference); err != nil {
+		return fmt.Errorf("fetching remote %s: %w", ref.String(), err)
+	}
+	action.remote = modeler
+	return nil
+}
+
+// newModeler initializes the model of the OCI remote at ref, which has yet to
+// be fetched.
+func (action *GitOCI) newModeler(ref registry.Reference) (model.Modeler, error) {
+	repo, err := newRepository(ref, action.version)
+	if err != nil {
+		return nil, err
+	}
+
+	modeler := model.NewModeler(repo)
+	if action.cache != nil {
+		modeler = model.WithCache(modeler, action.cache)
+	}
+	return modeler, nil
+}
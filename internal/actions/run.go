@@ -1,11 +1,21 @@
 package actions
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"io"
+	"log/slog"
 
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/act3-ai/gitoci/internal/cache"
 	"github.com/act3-ai/gitoci/internal/cmd"
+	"github.com/act3-ai/gitoci/internal/git"
+	"github.com/act3-ai/gitoci/internal/model"
+	"github.com/act3-ai/gitoci/internal/progress"
+	"github.com/act3-ai/gitoci/pkg/apis/gitoci.act3-ai.io/v1alpha1"
 )
 
 // GitOCI represents the base action
@@ -13,12 +23,39 @@ type GitOCI struct {
 	// TODO: Could be dangerous when storing in struct like this... mutex?
 	batcher cmd.BatchReadWriter
 
+	// in and out are used directly once a connection is established, see connect
+	in  io.Reader
+	out io.Writer
+
+	// pushCert is the certificate of a signed push, see receivePack
+	pushCert []byte
+
+	// progress is written to stderr, as stdout is reserved for Git
+	stderr io.Writer
+
 	// local repository
 	gitDir string
+	local  *filesystem.Storage // lazily opened, see openLocal
 
 	// OCI remote
 	name   string // may have same value as address
 	addess string
+	remote model.Modeler // lazily fetched, see fetchRemote
+
+	// cache holds fetched packfile layers, nil if disabled, see Configure
+	cache *cache.Cache
+
+	// concurrency is the number of layers transferred at once, see transferLimit
+	concurrency int
+
+	// layers larger than chunkThreshold are uploaded in chunks of chunkSize,
+	// chunked uploads are disabled if chunkSize is zero, see chunkedPush
+	chunkThreshold int64
+	chunkSize      int64
+
+	// fastImport offers import and export in place of connect, fetch and
+	// push, see capabilities
+	fastImport bool
 
 	Option
 
@@ -26,9 +63,14 @@ type GitOCI struct {
 }
 
 // NewGitOCI creates a new Tool with default values
-func NewGitOCI(in io.Reader, out io.Writer, gitDir, shortname, address, version string) *GitOCI {
+func NewGitOCI(in io.Reader, out, stderr io.Writer, gitDir, shortname, address, version string) *GitOCI {
+	// shared with the batcher, so data following a command isn't lost to its buffer
+	in = bufio.NewReader(in)
 	return &GitOCI{
 		batcher: cmd.NewBatcher(in, out),
+		in:      in,
+		out:     out,
+		stderr:  stderr,
 		gitDir:  gitDir,
 		name:    shortname,
 		addess:  address,
@@ -36,6 +78,51 @@ func NewGitOCI(in io.Reader, out io.Writer, gitDir, shortname, address, version
 	}
 }
 
+// Configure applies the user's configuration. A cache that can't be
+// initialized is disabled rather than failing the action.
+func (action *GitOCI) Configure(cfg v1alpha1.ConfigurationSpec) error {
+	if cfg.Transfer.Concurrency < 0 {
+		return fmt.Errorf("invalid transfer concurrency %d, must not be negative", cfg.Transfer.Concurrency)
+	}
+	action.concurrency = cfg.Transfer.Concurrency
+
+	threshold, err := resource.ParseQuantity(cfg.Transfer.ChunkThreshold)
+	if err != nil {
+		return fmt.Errorf("invalid transfer chunkThreshold %s: %w", cfg.Transfer.ChunkThreshold, err)
+	}
+	if threshold.Sign() < 0 {
+		return fmt.Errorf("invalid transfer chunkThreshold %s, must not be negative", cfg.Transfer.ChunkThreshold)
+	}
+	chunkSize, err := resource.ParseQuantity(cfg.Transfer.ChunkSize)
+	if err != nil {
+		return fmt.Errorf("invalid transfer chunkSize %s: %w", cfg.Transfer.ChunkSize, err)
+	}
+	if chunkSize.Sign() <= 0 {
+		return fmt.Errorf("invalid transfer chunkSize %s, must be positive", cfg.Transfer.ChunkSize)
+	}
+	action.chunkThreshold = threshold.Value()
+	action.chunkSize = chunkSize.Value()
+	action.fastImport = cfg.FastImport
+
+	if cfg.Cache.Disabled {
+		return nil
+	}
+
+	maxSize, err := resource.ParseQuantity(cfg.Cache.MaxSize)
+	if err != nil {
+		return fmt.Errorf("invalid cache maxSize %s: %w", cfg.Cache.MaxSize, err)
+	}
+
+	c, err := cache.New(cfg.Cache.Dir, maxSize.Value())
+	if err != nil {
+		slog.Warn("disabling packfile layer cache", "error", err)
+		return nil
+	}
+	action.cache = c
+
+	return nil
+}
+
 // Runs the Hello action
 func (action *GitOCI) Run(ctx context.Context) error {
 	// first command is always "capabilities"
@@ -70,15 +157,89 @@ func (action *GitOCI) Run(ctx context.Context) error {
 			if err := action.option(ctx, c); err != nil {
 				return err
 			}
+		case cmd.List:
+			if err := action.list(ctx, c); err != nil {
+				return err
+			}
+		case cmd.Fetch:
+			// fetch commands are sent in a batch, terminated by a blank line
+			batch, err := action.batcher.ReadBatch(ctx)
+			if err != nil {
+				return fmt.Errorf("reading fetch batch: %w", err)
+			}
+			if err := action.fetch(ctx, append([]cmd.Git{c}, batch...)); err != nil {
+				return err
+			}
+		case cmd.Import:
+			// import commands are sent in a batch, terminated by a blank line
+			batch, err := action.batcher.ReadBatch(ctx)
+			if err != nil {
+				return fmt.Errorf("reading import batch: %w", err)
+			}
+			if err := action.importRefs(ctx, append([]cmd.Git{c}, batch...)); err != nil {
+				return err
+			}
+		case cmd.Export:
+			if err := action.export(ctx); err != nil {
+				return err
+			}
+		case cmd.Connect:
+			connected, err := action.connect(ctx, c)
+			if err != nil {
+				return err
+			}
+			// the connection lasts until Git is done with the remote
+			done = connected
+		case cmd.Push:
+			// push commands are sent in a batch, terminated by a blank line
+			batch, err := action.batcher.ReadBatch(ctx)
+			if err != nil {
+				return fmt.Errorf("reading push batch: %w", err)
+			}
+			if err := action.push(ctx, append([]cmd.Git{c}, batch...)); err != nil {
+				return err
+			}
 		}
 	}
 
-	// // TODO: Next command is 'list', can be read in a batch
-	// slog.InfoContext(ctx, "reading batch")
-	// _, err = action.batcher.ReadBatch(ctx)
-	// if err != nil {
-	// 	return fmt.Errorf("reading batch input: %w", err)
-	// }
+	return nil
+}
+
+// openLocal returns the storage of the local repository, opening it on first use.
+func (action *GitOCI) openLocal() (*filesystem.Storage, error) {
+	if action.local != nil {
+		return action.local, nil
+	}
+
+	local, err := git.Open(action.gitDir)
+	if err != nil {
+		return nil, err
+	}
 
-	return fmt.Errorf("not implemented")
+	// remotes are fetched in the supported format too, so formats can't mix
+	f, err := git.RepositoryFormat(local)
+	switch {
+	case err != nil:
+		return nil, err
+	case f != git.SupportedFormat:
+		return nil, fmt.Errorf("local repository uses object format %s, expected %s%s", f, git.SupportedFormat, git.FormatHint(f))
+	}
+	action.local = local
+
+	return local, nil
+}
+
+// transferLimit returns the number of layers to transfer at once, layers are
+// transferred one at a time if not configured.
+func (action *GitOCI) transferLimit() int {
+	return max(action.concurrency, 1)
+}
+
+// meter returns a progress meter for a transfer of total layers, nil if
+// progress reporting is disabled or there is nothing to transfer.
+func (action *GitOCI) meter(title string, total int) *progress.Meter {
+	if !action.progress || total == 0 || action.stderr == nil {
+		return nil
+	}
+	return progress.NewMeter(action.stderr, title, total)
 }
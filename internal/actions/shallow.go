@@ -0,0 +1,158 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+
+	"github.com/act3-ai/gitoci/internal/cmd"
+	"github.com/act3-ai/gitoci/internal/git"
+	"github.com/act3-ai/gitoci/internal/model"
+	"github.com/act3-ai/gitoci/pkg/oci"
+)
+
+// fetchShallow fulfills a batch of fetch commands limited by the shallow
+// options set by Git. Packfile layers contain complete history, so they are
+// indexed in a temporary repository from which only the requested history is
+// copied into the local repository.
+//
+// Layers are indexed newest first, starting from those holding the wanted
+// commits, until the requested history can be resolved. Layers are
+// incremental, so the trees of a recent commit may refer to blobs first packed
+// in an old layer, and which layers are needed is unknown until they are
+// indexed. The number of older layers indexed doubles each time objects are
+// missing.
+//
+// See https://git-scm.com/docs/shallow.
+func (action *GitOCI) fetchShallow(ctx context.Context, remote model.Modeler, local *filesystem.Storage, cmds []cmd.Git) error {
+	cfg := remote.Config()
+	layers := remote.Layers()
+
+	want := make([]plumbing.Hash, 0, len(cmds))
+	newest, oldest := -1, len(layers)
+	for _, c := range cmds {
+		commit, name := plumbing.NewHash(c.Data[0]), plumbing.ReferenceName(c.Data[1])
+		idx, err := layerIndex(cfg, layers, name, commit)
+		if err != nil {
+			return err
+		}
+		newest, oldest = max(newest, idx), min(oldest, idx)
+		want = append(want, commit)
+	}
+
+	opts := git.ShallowOptions{
+		Depth: action.depth,
+		Since: action.deepenSince,
+	}
+	for _, name := range action.deepenNot {
+		h, err := resolveRemoteName(cfg, name)
+		if err != nil {
+			return err
+		}
+		opts.Not = append(opts.Not, h)
+	}
+	if action.deepenRelative {
+		existing, err := local.Shallow()
+		if err != nil {
+			return fmt.Errorf("reading shallow commits: %w", err)
+		}
+		opts.Relative, opts.Shallow = true, existing
+	}
+
+	tmpDir, tmp, err := git.InitTemp("git-remote-oci-shallow-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var objs, shallow []plumbing.Hash
+	indexed := newest + 1
+	for count := indexed - oldest; ; count *= 2 {
+		next := max(indexed-count, 0)
+		meter := action.meter("Receiving layers", indexed-next)
+		if err := action.indexLayers(ctx, remote, tmp, layers[next:indexed], meter); err != nil {
+			return err
+		}
+		meter.Finish()
+		indexed = next
+
+		objs, shallow, err = git.ShallowObjects(tmp, want, opts)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, plumbing.ErrObjectNotFound) || indexed == 0 {
+			return fmt.Errorf("resolving shallow history: %w", err)
+		}
+		slog.DebugContext(ctx, "shallow history refers to older layers", "indexed", newest+1-indexed, "error", err.Error())
+	}
+	slog.DebugContext(ctx, "resolved shallow history", "layers", newest+1-indexed, "objects", len(objs), "shallow", len(shallow))
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(packObjects(ctx, tmpDir, tmp, objs)(pw))
+	}()
+	if err := git.IndexPack(local, pr); err != nil {
+		_ = pr.CloseWithError(err)
+		return fmt.Errorf("indexing shallow history: %w", err)
+	}
+
+	return action.updateShallow(local, objs, shallow)
+}
+
+// updateShallow updates the shallow commits of the local repository. Existing
+// shallow commits fetched with their parents are no longer shallow.
+func (action *GitOCI) updateShallow(local *filesystem.Storage, fetched, shallow []plumbing.Hash) error {
+	existing, err := local.Shallow()
+	if err != nil {
+		return fmt.Errorf("reading shallow commits: %w", err)
+	}
+
+	result := slices.Clone(shallow)
+	for _, h := range existing {
+		deepened := slices.Contains(fetched, h) && !slices.Contains(shallow, h)
+		if !deepened && !slices.Contains(result, h) {
+			result = append(result, h)
+		}
+	}
+
+	if len(result) == 0 {
+		// the shallow file is shared by linked worktrees
+		err := local.Filesystem().Remove("shallow")
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("removing shallow file: %w", err)
+		}
+		return nil
+	}
+
+	if err := local.SetShallow(result); err != nil {
+		return fmt.Errorf("writing shallow commits: %w", err)
+	}
+	return nil
+}
+
+// resolveRemoteName resolves a full or short reference name, or object ID,
+// to an object in the remote.
+func resolveRemoteName(cfg oci.ConfigGit, name string) (plumbing.Hash, error) {
+	candidates := []plumbing.ReferenceName{
+		plumbing.ReferenceName(name),
+		plumbing.NewBranchReferenceName(name),
+		plumbing.NewTagReferenceName(name),
+	}
+	for _, ref := range candidates {
+		if info, ok := cfg.Reference(ref); ok {
+			return info.Commit, nil
+		}
+	}
+
+	if plumbing.IsHash(name) {
+		return plumbing.NewHash(name), nil
+	}
+	return plumbing.ZeroHash, fmt.Errorf("reference %s not found in remote", name)
+}
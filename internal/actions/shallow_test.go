@@ -0,0 +1,133 @@
+package actions
+
+import (
+	"context"
+	"io"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"oras.land/oras-go/v2/content/memory"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+
+	"github.com/act3-ai/gitoci/internal/cmd"
+	"github.com/act3-ai/gitoci/internal/git"
+	"github.com/act3-ai/gitoci/internal/model"
+)
+
+// fetchingModeler records the packfile layers fetched.
+type fetchingModeler struct {
+	model.Modeler
+	fetched []digest.Digest
+}
+
+// FetchLayer implements model.Modeler.
+func (m *fetchingModeler) FetchLayer(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+	m.fetched = append(m.fetched, desc.Digest)
+	return m.Modeler.FetchLayer(ctx, desc) //nolint:wrapcheck
+}
+
+// fileCommit stores a commit of a tree holding a single file in st, so each
+// commit has objects of its own.
+func fileCommit(t *testing.T, st *filesystem.Storage, content string, parents ...plumbing.Hash) plumbing.Hash {
+	t.Helper()
+
+	blobObj := &plumbing.MemoryObject{}
+	blobObj.SetType(plumbing.BlobObject)
+	if _, err := blobObj.Write([]byte(content)); err != nil {
+		t.Fatalf("writing blob: %v", err)
+	}
+	blob, err := st.SetEncodedObject(blobObj)
+	if err != nil {
+		t.Fatalf("storing blob: %v", err)
+	}
+
+	treeObj := st.NewEncodedObject()
+	tree := &object.Tree{Entries: []object.TreeEntry{{Name: "a.txt", Mode: filemode.Regular, Hash: blob}}}
+	if err := tree.Encode(treeObj); err != nil {
+		t.Fatalf("encoding tree: %v", err)
+	}
+	treeHash, err := st.SetEncodedObject(treeObj)
+	if err != nil {
+		t.Fatalf("storing tree: %v", err)
+	}
+
+	sig := object.Signature{Name: "Test", Email: "test@example.com", When: time.Unix(1700000000, 0).UTC()}
+	commit := &object.Commit{Author: sig, Committer: sig, Message: content, TreeHash: treeHash, ParentHashes: parents}
+	obj := st.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		t.Fatalf("encoding commit: %v", err)
+	}
+	h, err := st.SetEncodedObject(obj)
+	if err != nil {
+		t.Fatalf("storing commit: %v", err)
+	}
+	return h
+}
+
+func TestGitOCI_fetchShallow(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	pusher, _ := newRemoteAction(t, store, newTestStorage())
+
+	// a layer for each commit
+	var commits []plumbing.Hash
+	for _, content := range []string{"1", "2", "3", "4"} {
+		var parents []plumbing.Hash
+		if len(commits) > 0 {
+			parents = append(parents, commits[len(commits)-1])
+		}
+		commits = append(commits, fileCommit(t, pusher.local, content, parents...))
+		pushCommit(t, pusher, "refs/heads/main", commits[len(commits)-1])
+	}
+	layers := layerDigests(pusher.remote)
+
+	remote := &fetchingModeler{Modeler: pusher.remote}
+	local := newTestStorage()
+	action := &GitOCI{local: local, remote: remote}
+	cmds := []cmd.Git{{Cmd: cmd.Fetch, Data: []string{commits[3].String(), "refs/heads/main"}}}
+	hasCommit := func(h plumbing.Hash) bool {
+		t.Helper()
+		ok, err := git.HasObject(local, h)
+		if err != nil {
+			t.Fatalf("HasObject() error = %v", err)
+		}
+		return ok
+	}
+
+	// only the layer of the wanted commit is needed
+	action.depth = 1
+	if err := action.fetchShallow(ctx, remote, local, cmds); err != nil {
+		t.Fatalf("fetchShallow() error = %v", err)
+	}
+	assert.Equal(t, []digest.Digest{layers[3]}, remote.fetched)
+	shallow, err := local.Shallow()
+	if err != nil {
+		t.Fatalf("Shallow() error = %v", err)
+	}
+	assert.Equal(t, []plumbing.Hash{commits[3]}, shallow)
+
+	// git fetch --deepen=1 deepens from the shallow commit, not the tip,
+	// indexing older layers until the parent is found
+	remote.fetched = nil
+	action.deepenRelative = true
+	if err := action.fetchShallow(ctx, remote, local, cmds); err != nil {
+		t.Fatalf("fetchShallow() error = %v", err)
+	}
+	assert.NotContains(t, remote.fetched, layers[0])
+	shallow, err = local.Shallow()
+	if err != nil {
+		t.Fatalf("Shallow() error = %v", err)
+	}
+	assert.Equal(t, []plumbing.Hash{commits[2]}, shallow)
+	assert.True(t, hasCommit(commits[2]), "parent of the shallow commit not fetched")
+	assert.False(t, hasCommit(commits[1]), "fetched beyond the requested depth")
+	assert.True(t, slices.Contains(remote.fetched, layers[2]))
+}
@@ -0,0 +1,142 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2/content"
+
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/act3-ai/gitoci/internal/model"
+	"github.com/act3-ai/gitoci/pkg/oci"
+)
+
+// uploadsDir is the directory of interrupted layer uploads, kept in the
+// private directory of the remote, see privateDir.
+const uploadsDir = "uploads"
+
+// chunkedPush returns a function pushing a packfile layer of objs as it is
+// read. Layers up to the chunk threshold are buffered and uploaded in one
+// sized request, larger layers are uploaded in chunks, with the upload
+// session recorded under GIT_DIR so an interrupted upload of the same objects
+// can be resumed by a later push.
+func (action *GitOCI) chunkedPush(remote model.Modeler, objs []plumbing.Hash) func(ctx context.Context, r io.Reader) (ocispec.Descriptor, error) {
+	return func(ctx context.Context, r io.Reader) (ocispec.Descriptor, error) {
+		var head bytes.Buffer
+		_, err := io.CopyN(&head, r, action.chunkThreshold)
+		switch {
+		case errors.Is(err, io.EOF):
+			desc := content.NewDescriptorFromBytes(oci.MediaTypePackLayer, head.Bytes())
+			return desc, remote.PushLayer(ctx, desc, &head)
+		case err != nil:
+			return ocispec.Descriptor{}, fmt.Errorf("reading packfile layer: %w", err)
+		}
+
+		name := action.uploadSessionPath(objs)
+		opts := model.ChunkedUpload{ChunkSize: action.chunkSize}
+		if name != "" {
+			opts.Resume = readUploadSession(ctx, name)
+			opts.Save = func(session model.UploadSession) {
+				if err := writeUploadSession(name, session); err != nil {
+					slog.WarnContext(ctx, "not recording layer upload, it can't be resumed", "error", err)
+				}
+			}
+		}
+
+		desc, err := remote.PushLayerChunked(ctx, io.MultiReader(&head, r), opts)
+		switch {
+		case errors.Is(err, model.ErrUploadChanged):
+			// the next attempt starts over
+			removeUploadSession(ctx, name)
+			return ocispec.Descriptor{}, err
+		case err != nil:
+			// the session is kept so the next push resumes the upload
+			return ocispec.Descriptor{}, err
+		}
+		removeUploadSession(ctx, name)
+		return desc, nil
+	}
+}
+
+// uploadSessionPath returns the path of the upload session of a packfile
+// layer of objs, named by a digest of the remote and the objects, as the same
+// objects always produce the same packfile. An empty path is returned outside
+// of a repository, where sessions are not recorded, or without objs.
+func (action *GitOCI) uploadSessionPath(objs []plumbing.Hash) string {
+	if action.gitDir == "" || len(objs) == 0 {
+		return ""
+	}
+
+	sorted := slices.Clone(objs)
+	plumbing.HashesSort(sorted)
+	h := sha256.New()
+	h.Write([]byte(action.addess))
+	for _, obj := range sorted {
+		h.Write(obj[:])
+	}
+	return filepath.Join(action.privateDir(), uploadsDir, hex.EncodeToString(h.Sum(nil))+".json")
+}
+
+// readUploadSession reads a recorded upload session, nil if there is none or
+// it can't be read.
+func readUploadSession(ctx context.Context, name string) *model.UploadSession {
+	b, err := os.ReadFile(name)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil
+	case err != nil:
+		slog.WarnContext(ctx, "ignoring interrupted layer upload", "error", err)
+		return nil
+	}
+
+	var session model.UploadSession
+	if err := json.Unmarshal(b, &session); err != nil {
+		slog.WarnContext(ctx, "ignoring interrupted layer upload", "error", err)
+		return nil
+	}
+	return &session
+}
+
+// writeUploadSession records an upload session, replacing the previous one.
+func writeUploadSession(name string, session model.UploadSession) error {
+	b, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("encoding upload session: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return fmt.Errorf("creating uploads directory: %w", err)
+	}
+
+	// a partially written session would lose the upload
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return fmt.Errorf("writing upload session: %w", err)
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return fmt.Errorf("writing upload session: %w", err)
+	}
+	return nil
+}
+
+// removeUploadSession removes a recorded upload session, if any.
+func removeUploadSession(ctx context.Context, name string) {
+	if name == "" {
+		return
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.WarnContext(ctx, "removing layer upload session", "error", err)
+	}
+}
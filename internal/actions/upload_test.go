@@ -0,0 +1,45 @@
+package actions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/act3-ai/gitoci/internal/model"
+)
+
+func TestGitOCI_uploadSessionPath(t *testing.T) {
+	a := plumbing.NewHash("2f5bc3b4ea8aa6a1e0ef4c3d9fdf3ea1a3a1e2c4")
+	b := plumbing.NewHash("9157aac73eadb3b1a0527ea7171bb19c125679f1")
+
+	action := &GitOCI{gitDir: t.TempDir(), name: "origin", addess: "oci://example.com/repo:main"}
+	other := &GitOCI{gitDir: action.gitDir, name: "origin", addess: "oci://example.com/other:main"}
+
+	// the same objects, in any order, resume the same upload
+	assert.Equal(t, action.uploadSessionPath([]plumbing.Hash{a, b}), action.uploadSessionPath([]plumbing.Hash{b, a}))
+	assert.NotEqual(t, action.uploadSessionPath([]plumbing.Hash{a, b}), action.uploadSessionPath([]plumbing.Hash{a}))
+	assert.NotEqual(t, action.uploadSessionPath([]plumbing.Hash{a}), other.uploadSessionPath([]plumbing.Hash{a}))
+
+	// sessions aren't recorded outside of a repository
+	assert.Empty(t, (&GitOCI{}).uploadSessionPath([]plumbing.Hash{a}))
+}
+
+func Test_uploadSession(t *testing.T) {
+	ctx := context.Background()
+	action := &GitOCI{gitDir: t.TempDir(), name: "origin"}
+	name := action.uploadSessionPath([]plumbing.Hash{plumbing.NewHash("2f5bc3b4ea8aa6a1e0ef4c3d9fdf3ea1a3a1e2c4")})
+
+	assert.Nil(t, readUploadSession(ctx, name))
+
+	want := model.UploadSession{Location: "https://example.com/upload/1", Offset: 8, Digest: digest.FromString("PACK")}
+	if err := writeUploadSession(name, want); err != nil {
+		t.Fatalf("writeUploadSession() error = %v", err)
+	}
+	assert.Equal(t, &want, readUploadSession(ctx, name))
+
+	removeUploadSession(ctx, name)
+	assert.Nil(t, readUploadSession(ctx, name))
+}
@@ -0,0 +1,261 @@
+// Package cache keeps blobs fetched from OCI registries in a local directory,
+// keyed by digest, so repositories and remotes on a host share downloads.
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// Cache directory layout.
+const (
+	blobsDir = "blobs"
+	tmpDir   = "tmp"
+)
+
+// staleTemp is the age after which temporary files of interrupted writes are
+// removed.
+const staleTemp = 24 * time.Hour
+
+// ErrCorrupt indicates a cached blob does not match its digest.
+var ErrCorrupt = errors.New("corrupt blob removed from cache")
+
+// Cache is a directory of blobs named by digest. Once the combined size of its
+// blobs exceeds a limit, the least recently used are evicted.
+//
+// A Cache may be shared by concurrent processes. Blobs are written to
+// temporary files, and renamed into place once verified, so readers never see
+// partial blobs.
+type Cache struct {
+	dir     string
+	maxSize int64
+}
+
+// New initializes a Cache in dir, limited to maxSize bytes, creating dir if
+// it does not exist.
+func New(dir string, maxSize int64) (*Cache, error) {
+	for _, d := range []string{filepath.Join(dir, blobsDir), filepath.Join(dir, tmpDir)} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			return nil, fmt.Errorf("creating cache directory: %w", err)
+		}
+	}
+	return &Cache{dir: dir, maxSize: maxSize}, nil
+}
+
+// Open opens a cached blob, marking it as recently used. An error wrapping
+// fs.ErrNotExist is returned if the blob is not cached. The blob is verified
+// before it is returned, a corrupt blob is removed from the cache and
+// ErrCorrupt is returned.
+func (c *Cache) Open(dgst digest.Digest) (io.ReadCloser, error) {
+	name, err := c.path(dgst)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("opening cached blob %s: %w", dgst, err)
+	}
+
+	// blobs are verified up front, so callers can fall back to the registry
+	// before consuming any data
+	verifier := dgst.Verifier()
+	if _, err := io.Copy(verifier, f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("reading cached blob %s: %w", dgst, err)
+	}
+	if !verifier.Verified() {
+		f.Close()
+		_ = os.Remove(name)
+		return nil, fmt.Errorf("cached blob %s: %w", dgst, ErrCorrupt)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("reading cached blob %s: %w", dgst, err)
+	}
+
+	// modification times order blobs for eviction, see Evict
+	now := time.Now()
+	_ = os.Chtimes(name, now, now)
+
+	return f, nil
+}
+
+// Tee returns a reader of rc that caches the blob read from it. The blob is
+// cached when the reader is closed, if size bytes were read and they match
+// dgst. Readers need not read rc until io.EOF, e.g. a response body limited to
+// the size of the blob. Failing to cache the blob does not fail the read.
+func (c *Cache) Tee(dgst digest.Digest, size int64, rc io.ReadCloser) io.ReadCloser {
+	name, err := c.path(dgst)
+	if err != nil {
+		slog.Warn("not caching blob", "digest", dgst, "error", err)
+		return rc
+	}
+
+	f, err := os.CreateTemp(filepath.Join(c.dir, tmpDir), dgst.Encoded()+"-*")
+	if err != nil {
+		slog.Warn("not caching blob", "digest", dgst, "error", err)
+		return rc
+	}
+
+	return &teeReader{
+		rc:       rc,
+		f:        f,
+		name:     name,
+		expected: dgst,
+		size:     size,
+		digester: dgst.Algorithm().Digester(),
+		cache:    c,
+	}
+}
+
+// Evict removes the least recently used blobs until their combined size is
+// within the limit of the cache, along with stale temporary files.
+func (c *Cache) Evict() error {
+	type blob struct {
+		name    string
+		size    int64
+		modTime time.Time
+	}
+
+	var blobs []blob
+	var total int64
+	err := filepath.WalkDir(filepath.Join(c.dir, blobsDir), func(name string, d fs.DirEntry, err error) error {
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			// evicted concurrently
+			return nil
+		case err != nil:
+			return err
+		case d.IsDir():
+			return nil
+		}
+
+		fi, err := d.Info()
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			return nil
+		case err != nil:
+			return err
+		}
+		blobs = append(blobs, blob{name: name, size: fi.Size(), modTime: fi.ModTime()})
+		total += fi.Size()
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("reading cache: %w", err)
+	}
+
+	slices.SortFunc(blobs, func(a, b blob) int {
+		return a.modTime.Compare(b.modTime)
+	})
+	for _, b := range blobs {
+		if total <= c.maxSize {
+			break
+		}
+		slog.Debug("evicting cached blob", "path", b.name, "size", b.size)
+		if err := os.Remove(b.name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("evicting cached blob: %w", err)
+		}
+		total -= b.size
+	}
+
+	return c.removeStaleTemp()
+}
+
+// removeStaleTemp removes the temporary files of writes interrupted long ago.
+func (c *Cache) removeStaleTemp() error {
+	entries, err := os.ReadDir(filepath.Join(c.dir, tmpDir))
+	if err != nil {
+		return fmt.Errorf("reading cache: %w", err)
+	}
+
+	for _, e := range entries {
+		fi, err := e.Info()
+		if err != nil || time.Since(fi.ModTime()) < staleTemp {
+			continue
+		}
+		_ = os.Remove(filepath.Join(c.dir, tmpDir, e.Name()))
+	}
+	return nil
+}
+
+// path returns the path of a blob in the cache, blobs/<algorithm>/<encoded>.
+func (c *Cache) path(dgst digest.Digest) (string, error) {
+	if err := dgst.Validate(); err != nil {
+		return "", fmt.Errorf("invalid digest %s: %w", dgst, err)
+	}
+	return filepath.Join(c.dir, blobsDir, dgst.Algorithm().String(), dgst.Encoded()), nil
+}
+
+// teeReader writes a blob to a temporary file as it is read, moving it into
+// the cache when closed.
+type teeReader struct {
+	rc       io.ReadCloser
+	f        *os.File
+	name     string
+	expected digest.Digest
+	size     int64
+	digester digest.Digester
+	read     int64
+	failed   bool
+	cache    *Cache
+}
+
+// Read implements io.Reader.
+func (t *teeReader) Read(p []byte) (int, error) {
+	n, err := t.rc.Read(p)
+	if n > 0 && !t.failed {
+		if _, werr := t.f.Write(p[:n]); werr != nil {
+			slog.Warn("not caching blob", "digest", t.expected, "error", werr)
+			t.failed = true
+		}
+		_, _ = t.digester.Hash().Write(p[:n])
+	}
+	t.read += int64(n)
+	return n, err //nolint:wrapcheck
+}
+
+// Close implements io.Closer.
+func (t *teeReader) Close() error {
+	err := t.rc.Close()
+	if cerr := t.commit(); cerr != nil {
+		slog.Warn("not caching blob", "digest", t.expected, "error", cerr)
+	}
+	return err //nolint:wrapcheck
+}
+
+// commit moves the temporary file into the cache if the blob was read in full
+// and matches its digest, removing it otherwise. A blob is read in full once
+// its size is reached, whether or not the wrapped reader returned io.EOF.
+func (t *teeReader) commit() error {
+	tmp := t.f.Name()
+	defer os.Remove(tmp)
+
+	if err := t.f.Close(); err != nil {
+		return fmt.Errorf("writing cached blob: %w", err)
+	}
+	switch {
+	case t.failed, t.read != t.size:
+		return nil
+	case t.digester.Digest() != t.expected:
+		return fmt.Errorf("digest mismatch, got %s", t.digester.Digest())
+	}
+
+	if err := os.MkdirAll(filepath.Dir(t.name), 0o755); err != nil {
+		return fmt.Errorf("creating cache directory: %w", err)
+	}
+	if err := os.Rename(tmp, t.name); err != nil {
+		return fmt.Errorf("moving blob into cache: %w", err)
+	}
+	return t.cache.Evict()
+}
@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+)
+
+// add caches a blob through Tee, reading it in full.
+func add(t *testing.T, c *Cache, blob []byte) digest.Digest {
+	t.Helper()
+
+	dgst := digest.FromBytes(blob)
+	rc := c.Tee(dgst, int64(len(blob)), io.NopCloser(bytes.NewReader(blob)))
+	if _, err := io.Copy(io.Discard, rc); err != nil {
+		t.Fatalf("reading blob: %v", err)
+	}
+	if err := rc.Close(); err != nil {
+		t.Fatalf("closing blob: %v", err)
+	}
+	return dgst
+}
+
+func TestCache_Open(t *testing.T) {
+	c, err := New(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	blob := []byte("PACK")
+	dgst := digest.FromBytes(blob)
+	if _, err := c.Open(dgst); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Open() error = %v, want %v", err, fs.ErrNotExist)
+	}
+
+	add(t, c, blob)
+	rc, err := c.Open(dgst)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer rc.Close()
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("reading cached blob: %v", err)
+	}
+	assert.Equal(t, blob, got)
+}
+
+// blockingReader fails the test if read, standing in for a body that would
+// block past the end of a blob.
+type blockingReader struct{}
+
+func (blockingReader) Read([]byte) (int, error) {
+	panic("read past the end of the blob")
+}
+
+func TestCache_Tee(t *testing.T) {
+	blob := []byte("PACK")
+	dgst := digest.FromBytes(blob)
+
+	tests := []struct {
+		name   string
+		dgst   digest.Digest
+		read   int64
+		cached bool
+	}{
+		{name: "Read In Full", dgst: dgst, read: int64(len(blob)), cached: true},
+		{name: "Read Partially", dgst: dgst, read: 2},
+		{name: "Digest Mismatch", dgst: digest.FromString("other"), read: int64(len(blob))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(t.TempDir(), 1<<20)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			// the body never returns io.EOF, as with HTTP/2 responses read up
+			// to the size of the blob
+			body := io.MultiReader(bytes.NewReader(blob), blockingReader{})
+			rc := c.Tee(tt.dgst, int64(len(blob)), io.NopCloser(body))
+			if _, err := io.Copy(io.Discard, io.LimitReader(rc, tt.read)); err != nil {
+				t.Fatalf("reading blob: %v", err)
+			}
+			if err := rc.Close(); err != nil {
+				t.Fatalf("closing blob: %v", err)
+			}
+
+			_, err = c.Open(tt.dgst)
+			assert.Equal(t, tt.cached, err == nil, "Open() error = %v", err)
+		})
+	}
+}
+
+func TestCache_Evict(t *testing.T) {
+	// room for two blobs
+	c, err := New(t.TempDir(), 8)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	first := add(t, c, []byte("1111"))
+	second := add(t, c, []byte("2222"))
+
+	// using the first blob makes the second least recently used
+	past := time.Now().Add(-time.Hour)
+	name, err := c.path(second)
+	if err != nil {
+		t.Fatalf("path() error = %v", err)
+	}
+	if err := os.Chtimes(name, past, past); err != nil {
+		t.Fatalf("Chtimes() error = %v", err)
+	}
+	rc, err := c.Open(first)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	rc.Close()
+
+	third := add(t, c, []byte("3333"))
+
+	for _, tt := range []struct {
+		dgst   digest.Digest
+		cached bool
+	}{{first, true}, {second, false}, {third, true}} {
+		_, err := c.Open(tt.dgst)
+		assert.Equal(t, tt.cached, err == nil, "Open(%s) error = %v", tt.dgst, err)
+	}
+}
+
+func TestCache_Open_corrupt(t *testing.T) {
+	c, err := New(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	dgst := add(t, c, []byte("PACK"))
+	name, err := c.path(dgst)
+	if err != nil {
+		t.Fatalf("path() error = %v", err)
+	}
+	if err := os.WriteFile(name, []byte("JUNK"), 0o644); err != nil {
+		t.Fatalf("corrupting blob: %v", err)
+	}
+
+	_, err = c.Open(dgst)
+	assert.ErrorIs(t, err, ErrCorrupt)
+
+	_, err = c.Open(dgst)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/act3-ai/gitoci/internal/actions"
+)
+
+// newCompactCmd creates the compact command, which repacks the packfile
+// layers of an OCI remote.
+func newCompactCmd(version string) *cobra.Command {
+	var opts actions.CompactOptions
+
+	cmd := &cobra.Command{
+		Use:   "compact URL",
+		Short: "Repack the packfile layers of an OCI remote into one.",
+		Long: `Repack the packfile layers of an OCI remote into one. Each push adds a layer,
+so busy remotes accumulate many small layers that slow down fetches.
+
+With --geometric, older layers that are each at least FACTOR times larger than
+all newer layers combined are kept, so repeated compactions only repack recent
+history.
+
+The compacted layer is verified before the remote is updated. The digest of the
+previous manifest is printed, and recorded in the new manifest, so it can be
+restored until the registry removes it.`,
+		Example: `git-remote-oci compact oci://registry.example.com/repo:latest
+git-remote-oci compact --geometric 2 oci://registry.example.com/repo:latest`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			address := args[0]
+
+			action, err := newAction(cmd, "", address, address, version)
+			if err != nil {
+				return err
+			}
+			return action.Compact(cmd.Context(), opts)
+		},
+	}
+
+	cmd.Flags().Float64Var(&opts.Geometric, "geometric", 0, "keep older layers larger than FACTOR times all newer layers combined")
+	cmd.Flags().BoolVar(&opts.DryRun, "dry-run", false, "build the compacted layer without updating the remote")
+
+	return cmd
+}
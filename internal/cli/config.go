@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/act3-ai/go-common/pkg/config"
+	"github.com/act3-ai/go-common/pkg/logger"
+
+	"github.com/act3-ai/gitoci/internal/actions"
+	"github.com/act3-ai/gitoci/pkg/apis"
+	"github.com/act3-ai/gitoci/pkg/apis/gitoci.act3-ai.io/v1alpha1"
+)
+
+// configEnv overrides the configuration file search path, a list of paths.
+const configEnv = "GITOCI_CONFIG"
+
+// configSearchPath returns the paths searched for a configuration file. Git
+// runs remote helpers in the working tree of the repository, so unlike other
+// tools the working directory is not searched, as its content isn't trusted.
+func configSearchPath() []string {
+	paths := config.DefaultConfigSearchPath("git-remote-oci", "config.yaml")
+	return config.EnvPathOr(configEnv, paths[1:])
+}
+
+// newAction creates a GitOCI action, configured by the first configuration
+// file found, see configSearchPath.
+func newAction(cmd *cobra.Command, gitDir, name, address, version string) (*actions.GitOCI, error) {
+	cfg := &v1alpha1.Configuration{}
+	if err := config.Load(logger.FromContext(cmd.Context()), apis.NewScheme(), cfg, configSearchPath()); err != nil {
+		return nil, err
+	}
+
+	action := actions.NewGitOCI(cmd.InOrStdin(), cmd.OutOrStdout(), cmd.ErrOrStderr(), gitDir, name, address, version)
+	if err := action.Configure(cfg.ConfigurationSpec); err != nil {
+		return nil, err
+	}
+	return action, nil
+}
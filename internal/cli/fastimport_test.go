@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/act3-ai/gitoci/internal/git"
+)
+
+// TestMain runs the test binary as the remote helper when Git invokes it by
+// the name git-remote-oci, see installHelper.
+func TestMain(m *testing.M) {
+	if filepath.Base(os.Args[0]) == "git-remote-oci" {
+		if err := NewCLI("test").Execute(); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// installHelper makes the test binary Git's remote helper for oci:// URLs,
+// configured by config.
+func installHelper(t *testing.T, config string) {
+	t.Helper()
+
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatalf("resolving test binary: %v", err)
+	}
+	bin := t.TempDir()
+	if err := os.Symlink(exe, filepath.Join(bin, "git-remote-oci")); err != nil {
+		t.Fatalf("installing remote helper: %v", err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	cfg := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(cfg, []byte(config), 0o644); err != nil {
+		t.Fatalf("writing helper config: %v", err)
+	}
+	t.Setenv(configEnv, cfg)
+
+	// isolated from the user's Git and registry configuration
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_NAME", "A U Thor")
+	t.Setenv("GIT_AUTHOR_EMAIL", "author@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "A U Thor")
+	t.Setenv("GIT_COMMITTER_EMAIL", "author@example.com")
+}
+
+// runGit runs a Git command in dir, returning its trimmed output.
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// commitFile commits a file to the repository in dir.
+func commitFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatalf("writing %s: %v", name, err)
+	}
+	runGit(t, dir, "add", name)
+	runGit(t, dir, "commit", "-q", "-m", "add "+name)
+}
+
+func TestFastImport(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	installHelper(t, `apiVersion: gitoci.act3-ai.io/v1alpha1
+kind: Configuration
+fastImport: true
+cache:
+  disabled: true
+`)
+
+	srv := httptest.NewServer(newTestRegistry())
+	defer srv.Close()
+	url := "oci://" + strings.TrimPrefix(srv.URL, "http://") + "/repo:v1"
+
+	src := t.TempDir()
+	runGit(t, src, "init", "-q", "-b", "main", "--object-format="+string(git.SupportedFormat))
+	commitFile(t, src, "a.txt", "hello\n")
+	runGit(t, src, "tag", "-a", "v1", "-m", "release")
+	runGit(t, src, "remote", "add", "origin", url)
+	runGit(t, src, "push", "-q", "origin", "main", "v1")
+
+	// exports are recorded in the marks file of the remote
+	marks, err := os.ReadFile(filepath.Join(src, ".git", "oci", "origin", "git.marks"))
+	if err != nil {
+		t.Fatalf("reading marks: %v", err)
+	}
+	assert.NotEmpty(t, marks, "push did not export through fast-export")
+
+	dst := filepath.Join(t.TempDir(), "clone")
+	runGit(t, "", "clone", "-q", url, dst)
+	assert.Equal(t, runGit(t, src, "rev-parse", "HEAD"), runGit(t, dst, "rev-parse", "HEAD"))
+	assert.Equal(t, runGit(t, src, "rev-parse", "v1"), runGit(t, dst, "rev-parse", "v1"))
+	assert.Equal(t, "hello", runGit(t, dst, "show", "HEAD:a.txt"))
+
+	// later exports build on the marks of earlier ones
+	commitFile(t, src, "b.txt", "world\n")
+	runGit(t, src, "push", "-q", "origin", "main")
+	runGit(t, dst, "pull", "-q", "--ff-only")
+	assert.Equal(t, runGit(t, src, "rev-parse", "HEAD"), runGit(t, dst, "rev-parse", "HEAD"))
+	assert.Equal(t, "world", runGit(t, dst, "show", "HEAD:b.txt"))
+}
@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/act3-ai/gitoci/internal/actions"
+)
+
+// newGCCmd creates the gc command, which drops packfile layers no longer
+// required by the references of an OCI remote.
+func newGCCmd(version string) *cobra.Command {
+	var opts actions.GCOptions
+
+	cmd := &cobra.Command{
+		Use:   "gc URL",
+		Short: "Drop packfile layers no longer required by an OCI remote.",
+		Long: `Drop packfile layers no longer required by an OCI remote. Force pushes and
+deleted references leave objects behind in the layers of the remote, which are
+kept until collected.
+
+Layers without any object reachable from a reference are dropped, layers with
+only some are repacked. Repacked layers are verified before the remote is
+updated. The digest of the previous manifest is printed, and recorded in the new
+manifest.
+
+Dropped layers remain in the registry while old manifests refer to them. Delete
+old manifests with --delete-previous, or by digest with --delete-manifest, e.g.
+those printed by compact, so the registry can garbage collect their blobs.`,
+		Example: `git-remote-oci gc oci://registry.example.com/repo:latest
+git-remote-oci gc --delete-previous oci://registry.example.com/repo:latest
+git-remote-oci gc --delete-manifest sha256:... oci://registry.example.com/repo:latest`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			address := args[0]
+
+			action, err := newAction(cmd, "", address, address, version)
+			if err != nil {
+				return err
+			}
+			return action.GC(cmd.Context(), opts)
+		},
+	}
+
+	cmd.Flags().StringArrayVar(&opts.DeleteManifests, "delete-manifest", nil, "delete an old manifest by `DIGEST`, may be repeated")
+	cmd.Flags().BoolVar(&opts.DeletePrevious, "delete-previous", false, "delete the manifest replaced by the collection")
+	cmd.Flags().BoolVar(&opts.DryRun, "dry-run", false, "report what would be collected without updating the remote")
+
+	return cmd
+}
@@ -1,12 +1,12 @@
 package cli
 
 import (
-	"fmt"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 
-	"github.com/act3-ai/gitoci/internal/actions"
+	"github.com/act3-ai/gitoci/internal/git"
 )
 
 // NewCLI creates the base git-remote-oci command
@@ -19,17 +19,90 @@ func NewCLI(version string) *cobra.Command {
 		Args:         cobra.RangeArgs(1, 2),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// https://git-scm.com/docs/gitremote-helpers#_invocation
-			name, address := args[0], args[1]
-
-			gitDir, ok := os.LookupEnv("GIT_DIR")
-			if !ok {
-				return fmt.Errorf("GIT_DIR not set")
-			}
-
-			action := actions.NewGitOCI(cmd.InOrStdin(), cmd.OutOrStdout(), gitDir, name, address, version)
-			return action.Run(cmd.Context())
+			return runHelper(cmd, version, args[0], args[1])
 		},
 	}
 
+	// subcommands share positional arguments with Git's invocation, keep them few
+	cmd.CompletionOptions.DisableDefaultCmd = true
+	cmd.AddCommand(
+		newSetHeadCmd(version),
+		newPushCertsCmd(version),
+		newCompactCmd(version),
+		newGCCmd(version),
+	)
+	for _, sub := range cmd.Commands() {
+		guardHelper(sub, version)
+	}
+
 	return cmd
 }
+
+// runHelper runs the remote helper for a remote, reading commands from Git.
+func runHelper(cmd *cobra.Command, version, name, address string) error {
+	// GIT_DIR is not set when run outside of a repository, e.g. git ls-remote
+	gitDir := os.Getenv("GIT_DIR")
+
+	action, err := newAction(cmd, gitDir, name, address, version)
+	if err != nil {
+		return err
+	}
+	return action.Run(cmd.Context())
+}
+
+// guardHelper runs the remote helper in place of a subcommand when Git
+// invokes it for a remote named after the subcommand, e.g. git fetch gc runs
+// "git-remote-oci gc URL", which must not collect the remote.
+func guardHelper(sub *cobra.Command, version string) {
+	args, runE := sub.Args, sub.RunE
+	sub.Args = func(cmd *cobra.Command, a []string) error {
+		if invokedByGit(cmd, a) || args == nil {
+			return nil
+		}
+		return args(cmd, a)
+	}
+	sub.RunE = func(cmd *cobra.Command, a []string) error {
+		if invokedByGit(cmd, a) {
+			return runHelper(cmd, version, cmd.Name(), a[0])
+		}
+		return runE(cmd, a)
+	}
+}
+
+// invokedByGit returns true if a subcommand was invoked as Git invokes remote
+// helpers, "git-remote-oci <remote> <url>", where remote is configured with url
+// in GIT_DIR. Subcommands take a single URL, so "git-remote-oci gc URL" run by
+// a hook collects the remote unless a remote named gc has that URL.
+//
+// https://git-scm.com/docs/gitremote-helpers#_invocation
+func invokedByGit(cmd *cobra.Command, args []string) bool {
+	if len(args) != 1 || cmd.Flags().NFlag() != 0 {
+		return false
+	}
+	return remoteURL(os.Getenv("GIT_DIR"), cmd.Name(), args[0])
+}
+
+// remoteURL returns true if remote name is configured in the repository at
+// gitDir with url as its url or pushurl.
+func remoteURL(gitDir, name, url string) bool {
+	if gitDir == "" {
+		return false
+	}
+	st, err := git.Open(gitDir)
+	if err != nil {
+		return false
+	}
+	cfg, err := st.Config()
+	if err != nil {
+		return false
+	}
+
+	remote := cfg.Raw.Section("remote").Subsection(name)
+	for _, u := range append(remote.OptionAll("url"), remote.OptionAll("pushurl")...) {
+		// Git strips the transport of <transport>::<address> URLs
+		if strings.TrimPrefix(u, "oci::") == url {
+			return true
+		}
+	}
+	return false
+}
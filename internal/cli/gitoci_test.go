@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_invokedByGit(t *testing.T) {
+	const config = `[remote "gc"]
+	url = oci://registry.example.com/repo:latest
+[remote "mirror"]
+	url = oci::registry.example.com/mirror:latest
+	pushurl = oci://registry.example.com/push:latest
+`
+	gitDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(gitDir, "config"), []byte(config), 0o644); err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		cmd    string
+		gitDir string
+		args   []string
+		flags  []string
+		want   bool
+	}{
+		{
+			name:   "Configured Remote",
+			cmd:    "gc",
+			gitDir: gitDir,
+			args:   []string{"oci://registry.example.com/repo:latest"},
+			want:   true,
+		},
+		{
+			name:   "Transport Prefix",
+			cmd:    "mirror",
+			gitDir: gitDir,
+			args:   []string{"registry.example.com/mirror:latest"},
+			want:   true,
+		},
+		{
+			name:   "Push URL",
+			cmd:    "mirror",
+			gitDir: gitDir,
+			args:   []string{"oci://registry.example.com/push:latest"},
+			want:   true,
+		},
+		{
+			name:   "Other URL",
+			cmd:    "gc",
+			gitDir: gitDir,
+			args:   []string{"oci://registry.example.com/other:latest"},
+		},
+		{
+			name:   "Unconfigured Remote",
+			cmd:    "compact",
+			gitDir: gitDir,
+			args:   []string{"oci://registry.example.com/repo:latest"},
+		},
+		{
+			name: "Outside Repository",
+			cmd:  "gc",
+			args: []string{"oci://registry.example.com/repo:latest"},
+		},
+		{
+			name:   "Flags",
+			cmd:    "gc",
+			gitDir: gitDir,
+			args:   []string{"oci://registry.example.com/repo:latest"},
+			flags:  []string{"--dry-run"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GIT_DIR", tt.gitDir)
+
+			cmd := &cobra.Command{Use: tt.cmd + " URL"}
+			cmd.Flags().Bool("dry-run", false, "")
+			if err := cmd.Flags().Parse(tt.flags); err != nil {
+				t.Fatalf("parsing flags: %v", err)
+			}
+
+			assert.Equal(t, tt.want, invokedByGit(cmd, tt.args))
+		})
+	}
+}
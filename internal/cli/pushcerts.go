@@ -0,0 +1,28 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// newPushCertsCmd creates the push-certs command, which prints the push
+// certificates of an OCI remote.
+func newPushCertsCmd(version string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "push-certs URL",
+		Short: "Print the push certificates of the latest signed push to an OCI remote.",
+		Long: `Print the push certificates of the latest push to an OCI remote, made with
+git push --signed. Certificates are stored as artifacts referring to the manifest
+they were pushed with, and printed as signed, for verification with gpg or ssh-keygen.`,
+		Example: "git-remote-oci push-certs oci://registry.example.com/repo:latest",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			address := args[0]
+
+			action, err := newAction(cmd, "", address, address, version)
+			if err != nil {
+				return err
+			}
+			return action.PushCerts(cmd.Context())
+		},
+	}
+}
@@ -0,0 +1,171 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// testRegistry is an in-memory OCI registry, serving the parts of the
+// distribution spec used by git-remote-oci.
+//
+// https://github.com/opencontainers/distribution-spec/blob/main/spec.md
+type testRegistry struct {
+	mu        sync.Mutex
+	blobs     map[digest.Digest][]byte
+	manifests map[digest.Digest]manifest
+	tags      map[string]digest.Digest
+	uploads   map[string]*bytes.Buffer
+}
+
+// manifest is a manifest stored in a testRegistry.
+type manifest struct {
+	mediaType string
+	content   []byte
+}
+
+// newTestRegistry returns an empty testRegistry.
+func newTestRegistry() *testRegistry {
+	return &testRegistry{
+		blobs:     make(map[digest.Digest][]byte),
+		manifests: make(map[digest.Digest]manifest),
+		tags:      make(map[string]digest.Digest),
+		uploads:   make(map[string]*bytes.Buffer),
+	}
+}
+
+// ServeHTTP implements http.Handler, for a registry of any repositories
+// sharing their content.
+func (reg *testRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/v2/")
+	if path == "" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// <name>/<kind>/<reference>, where name may contain slashes
+	var kind, ref string
+	for _, k := range []string{"/blobs/uploads/", "/blobs/", "/manifests/"} {
+		if i := strings.LastIndex(path, k); i >= 0 {
+			kind, ref = strings.Trim(k, "/"), path[i+len(k):]
+			break
+		}
+	}
+
+	switch kind {
+	case "blobs/uploads":
+		reg.serveUpload(w, r, ref)
+	case "blobs":
+		b, ok := reg.blobs[digest.Digest(ref)]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		serveContent(w, r, "application/octet-stream", b)
+	case "manifests":
+		reg.serveManifest(w, r, ref)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// serveUpload serves blob upload sessions, named by id.
+func (reg *testRegistry) serveUpload(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method == http.MethodPost {
+		id = strconv.Itoa(len(reg.uploads) + 1)
+		reg.uploads[id] = &bytes.Buffer{}
+		w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/")+"/"+id)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	buf, ok := reg.uploads[id]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodGet {
+		if _, err := io.Copy(buf, r.Body); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodPatch:
+		w.Header().Set("Location", r.URL.Path)
+		w.Header().Set("Range", fmt.Sprintf("0-%d", max(buf.Len()-1, 0)))
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodPut:
+		dgst := digest.Digest(r.URL.Query().Get("digest"))
+		if digest.FromBytes(buf.Bytes()) != dgst {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		reg.blobs[dgst] = buf.Bytes()
+		delete(reg.uploads, id)
+		w.Header().Set("Docker-Content-Digest", dgst.String())
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// serveManifest serves manifests, referenced by tag or digest.
+func (reg *testRegistry) serveManifest(w http.ResponseWriter, r *http.Request, ref string) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		dgst, ok := reg.tags[ref]
+		if !ok {
+			dgst = digest.Digest(ref)
+		}
+		man, ok := reg.manifests[dgst]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		serveContent(w, r, man.mediaType, man.content)
+	case http.MethodPut:
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		dgst := digest.FromBytes(b)
+		reg.manifests[dgst] = manifest{mediaType: r.Header.Get("Content-Type"), content: b}
+		if digest.Digest(ref).Validate() != nil {
+			reg.tags[ref] = dgst
+		}
+		w.Header().Set("Docker-Content-Digest", dgst.String())
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		delete(reg.manifests, digest.Digest(ref))
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// serveContent serves a blob or manifest.
+func serveContent(w http.ResponseWriter, r *http.Request, mediaType string, b []byte) {
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	w.Header().Set("Docker-Content-Digest", digest.FromBytes(b).String())
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(b)
+	}
+}
@@ -0,0 +1,26 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// newSetHeadCmd creates the set-head command, which sets the remote HEAD.
+func newSetHeadCmd(version string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "set-head URL BRANCH",
+		Short: "Set the branch the HEAD of an OCI remote refers to.",
+		Long: `Set the branch the HEAD of an OCI remote refers to, which is checked out by
+git clone. The first push to a remote sets HEAD to the branch of the local HEAD.`,
+		Example: "git-remote-oci set-head oci://registry.example.com/repo:latest main",
+		Args:    cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			address, branch := args[0], args[1]
+
+			action, err := newAction(cmd, "", address, address, version)
+			if err != nil {
+				return err
+			}
+			return action.SetHead(cmd.Context(), branch)
+		},
+	}
+}
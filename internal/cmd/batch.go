@@ -4,9 +4,11 @@ package cmd
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"strings"
 )
 
 // BatchReadWriter supports both reading from and writing to Git in batches.
@@ -55,29 +57,29 @@ type Writer interface {
 
 // batcher implements BatchReadWriter.
 type batcher struct {
-	in  *bufio.Scanner
+	in  *bufio.Reader
 	out *bufio.Writer
 }
 
-// NewBatcher returns a buffered BatchReadWriter.
+// NewBatcher returns a buffered BatchReadWriter. If in is a *bufio.Reader it
+// is used directly, allowing the caller to read data that follows a command,
+// e.g. the fast-export stream following 'export'.
 func NewBatcher(in io.Reader, out io.Writer) BatchReadWriter {
 	return &batcher{
-		in:  bufio.NewScanner(in),
+		in:  bufio.NewReader(in),
 		out: bufio.NewWriter(out),
 	}
 }
 
 // Read parses a single command received by Git.
 func (b *batcher) Read(ctx context.Context) (Git, error) {
-	ok := b.in.Scan()
+	txt, err := b.readLine()
 	switch {
-	case !ok && b.in.Err() != nil:
-		return Git{}, fmt.Errorf("reading single command from Git: %w", b.in.Err())
-	case !ok:
-		// EOF
+	case errors.Is(err, io.EOF):
 		return Git{Cmd: Empty}, nil
+	case err != nil:
+		return Git{}, fmt.Errorf("reading single command from Git: %w", err)
 	default:
-		txt := b.in.Text()
 		slog.DebugContext(ctx, "read line from Git", "text", txt)
 		cmd, err := parse(ctx, txt)
 		if err != nil {
@@ -90,21 +92,33 @@ func (b *batcher) Read(ctx context.Context) (Git, error) {
 // ReadBatch reads lines from Git until an empty line is encountered.
 func (b *batcher) ReadBatch(ctx context.Context) ([]Git, error) {
 	result := make([]Git, 0, 2)
-	for b.in.Scan() {
-		line := b.in.Text()
-		if line == "" {
-			break
+	for {
+		line, err := b.readLine()
+		switch {
+		case errors.Is(err, io.EOF):
+			return result, nil
+		case err != nil:
+			return result, fmt.Errorf("scanning input: %w", err)
+		case line == "":
+			return result, nil
 		}
+
 		cmd, err := parse(ctx, line)
 		if err != nil {
 			return nil, fmt.Errorf("parsing Git command: %w", err)
 		}
 		result = append(result, cmd)
 	}
-	if b.in.Err() != nil {
-		return result, fmt.Errorf("scanning input: %w", b.in.Err())
+}
+
+// readLine reads a single line, without its line ending. io.EOF is only
+// returned if no data remains.
+func (b *batcher) readLine() (string, error) {
+	line, err := b.in.ReadString('\n')
+	if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+		return "", err //nolint:wrapcheck
 	}
-	return result, nil
+	return strings.TrimRight(line, "\r\n"), nil
 }
 
 // WriteBatch writes Message(s) to Git, completing the batch with a blank line, and flushing the buffered writes to Git.
@@ -41,6 +41,148 @@ func Test_batcher_Read(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "Option CAS",
+			mockGitOut: []string{
+				"option cas refs/heads/main:2f5bc3b4ea8aa6a1e0ef4c3d9fdf3ea1a3a1e2c4",
+			},
+			want: Git{
+				Cmd:    Option,
+				SubCmd: OptionCAS,
+				Data:   []string{"refs/heads/main:2f5bc3b4ea8aa6a1e0ef4c3d9fdf3ea1a3a1e2c4"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Option Object-Format Without Value",
+			mockGitOut: []string{
+				"option object-format",
+			},
+			want: Git{
+				Cmd:    Option,
+				SubCmd: OptionObjectFormat,
+				Data:   []string{"true"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Option Deepen-Since",
+			mockGitOut: []string{
+				"option deepen-since 2 weeks ago",
+			},
+			want: Git{
+				Cmd:    Option,
+				SubCmd: OptionDeepenSince,
+				Data:   []string{"2 weeks ago"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "List",
+			mockGitOut: []string{
+				"list",
+			},
+			want: Git{
+				Cmd:    List,
+				SubCmd: "",
+				Data:   []string{},
+			},
+			wantErr: false,
+		},
+		{
+			name: "List For-Push",
+			mockGitOut: []string{
+				"list for-push",
+			},
+			want: Git{
+				Cmd:    List,
+				SubCmd: ListForPush,
+				Data:   []string{},
+			},
+			wantErr: false,
+		},
+		{
+			name: "List Invalid",
+			mockGitOut: []string{
+				"list for-fetch",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Fetch",
+			mockGitOut: []string{
+				"fetch 2f5bc3b4ea8aa6a1e0ef4c3d9fdf3ea1a3a1e2c4 refs/heads/main",
+			},
+			want: Git{
+				Cmd:    Fetch,
+				SubCmd: "",
+				Data:   []string{"2f5bc3b4ea8aa6a1e0ef4c3d9fdf3ea1a3a1e2c4", "refs/heads/main"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Fetch Missing Name",
+			mockGitOut: []string{
+				"fetch 2f5bc3b4ea8aa6a1e0ef4c3d9fdf3ea1a3a1e2c4",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Push",
+			mockGitOut: []string{
+				"push +refs/heads/main:refs/heads/main",
+			},
+			want: Git{
+				Cmd:    Push,
+				SubCmd: "",
+				Data:   []string{"+refs/heads/main:refs/heads/main"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Connect",
+			mockGitOut: []string{
+				"connect git-upload-pack",
+			},
+			want: Git{
+				Cmd:    Connect,
+				SubCmd: UploadPack,
+				Data:   []string{},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Connect Missing Service",
+			mockGitOut: []string{
+				"connect",
+			},
+			want:    Git{},
+			wantErr: true,
+		},
+		{
+			name: "Import",
+			mockGitOut: []string{
+				"import refs/heads/main",
+			},
+			want: Git{
+				Cmd:    Import,
+				SubCmd: "",
+				Data:   []string{"refs/heads/main"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Export",
+			mockGitOut: []string{
+				"export",
+			},
+			want: Git{
+				Cmd:    Export,
+				SubCmd: "",
+				Data:   []string{},
+			},
+			wantErr: false,
+		},
 		{
 			name: "Empty/Done",
 			mockGitOut: []string{
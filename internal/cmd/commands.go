@@ -23,10 +23,17 @@ type Type string
 const (
 	// Git conventions
 	Capabilities Type = "capabilities"
-	// Push                 = "push"
-	// Fetch                = "fetch"
-	// List                 = "list"
-	// ListForPush       = "for-push"
+	Push         Type = "push"
+	Fetch        Type = "fetch"
+	List         Type = "list"
+	ListForPush  Type = "for-push"
+	Connect      Type = "connect"
+	Import       Type = "import"
+	Export       Type = "export"
+
+	// services requested by connect
+	UploadPack  Type = "git-upload-pack"
+	ReceivePack Type = "git-receive-pack"
 
 	// not a Git convention, marks end of input
 	Empty Type = "empty"
@@ -34,18 +41,48 @@ const (
 
 var Commands = []Type{
 	Capabilities,
+	List,
+	Fetch,
+	Push,
+	Connect,
+	Import,
+	Export,
 	Empty,
 }
 
 // https://git-scm.com/docs/gitremote-helpers#_options
 const (
-	Option          Type = "option"
-	OptionVerbosity Type = "verbosity"
+	Option             Type = "option"
+	OptionVerbosity    Type = "verbosity"
+	OptionCAS          Type = "cas"
+	OptionDepth        Type = "depth"
+	OptionDeepenSince  Type = "deepen-since"
+	OptionDeepenNot    Type = "deepen-not"
+	OptionDeepenRel    Type = "deepen-relative"
+	OptionProgress     Type = "progress"
+	OptionDryRun       Type = "dry-run"
+	OptionAtomic       Type = "atomic"
+	OptionForce        Type = "force"
+	OptionObjectFormat Type = "object-format"
+	OptionCheckConn    Type = "check-connectivity"
+	OptionPushCert     Type = "pushcert"
 )
 
 var Options = []Type{
 	Option,
 	OptionVerbosity,
+	OptionCAS,
+	OptionDepth,
+	OptionDeepenSince,
+	OptionDeepenNot,
+	OptionDeepenRel,
+	OptionProgress,
+	OptionDryRun,
+	OptionAtomic,
+	OptionForce,
+	OptionObjectFormat,
+	OptionCheckConn,
+	OptionPushCert,
 }
 
 // Git represents a parsed command received from Git. It may include a
@@ -85,31 +122,118 @@ func parse(ctx context.Context, line string) (Git, error) {
 		return Git{
 			Cmd: Capabilities,
 		}, nil
+	case List:
+		return parseList(ctx, fields...)
+	case Fetch:
+		// fetch <sha1> <name>
+		if len(fields) != 3 {
+			slog.ErrorContext(ctx, "invalid number of arguments to fetch command",
+				"got", fmt.Sprintf("%d", len(fields)),
+				"want", "3")
+			return Git{}, fmt.Errorf("invalid number of args to fetch command")
+		}
+
+		return Git{
+			Cmd:  Fetch,
+			Data: fields[1:],
+		}, nil
+	case Push:
+		// push [+]<src>:<dst>
+		if len(fields) != 2 {
+			slog.ErrorContext(ctx, "invalid number of arguments to push command",
+				"got", fmt.Sprintf("%d", len(fields)),
+				"want", "2")
+			return Git{}, fmt.Errorf("invalid number of args to push command")
+		}
+
+		return Git{
+			Cmd:  Push,
+			Data: fields[1:],
+		}, nil
+	case Connect:
+		// connect <service>
+		if len(fields) != 2 {
+			slog.ErrorContext(ctx, "invalid number of arguments to connect command",
+				"got", fmt.Sprintf("%d", len(fields)),
+				"want", "2")
+			return Git{}, fmt.Errorf("invalid number of args to connect command")
+		}
+
+		return Git{
+			Cmd:    Connect,
+			SubCmd: Type(fields[1]),
+		}, nil
+	case Import:
+		// import <name>
+		if len(fields) != 2 {
+			slog.ErrorContext(ctx, "invalid number of arguments to import command",
+				"got", fmt.Sprintf("%d", len(fields)),
+				"want", "2")
+			return Git{}, fmt.Errorf("invalid number of args to import command")
+		}
+
+		return Git{
+			Cmd:  Import,
+			Data: fields[1:],
+		}, nil
+	case Export:
+		return Git{
+			Cmd: Export,
+		}, nil
 	case Option:
+		// Git requests the object format without a value after connect falls back
+		if len(fields) == 2 && Type(fields[1]) == OptionObjectFormat {
+			return Git{
+				Cmd:    Option,
+				SubCmd: OptionObjectFormat,
+				Data:   []string{"true"},
+			}, nil
+		}
+
 		if err := validOption(ctx, fields...); err != nil {
 			return Git{}, err
 		}
 
+		// values may contain spaces, e.g. 'option deepen-since 1 week ago'
+		value := strings.SplitN(strings.TrimSpace(line), " ", 3)[2]
 		return Git{
 			Cmd:    Option,
 			SubCmd: Type(fields[1]),
-			Data:   fields[2:],
+			Data:   []string{value},
 		}, nil
 	default:
 		return Git{}, fmt.Errorf("%w: %s", ErrUnsupportedCommand, cmd)
 	}
 }
 
+// parseList parses a list command, which may include the for-push subcommand.
+func parseList(ctx context.Context, fields ...string) (Git, error) {
+	switch {
+	case len(fields) == 1:
+		return Git{
+			Cmd: List,
+		}, nil
+	case len(fields) == 2 && Type(fields[1]) == ListForPush:
+		return Git{
+			Cmd:    List,
+			SubCmd: ListForPush,
+		}, nil
+	default:
+		slog.ErrorContext(ctx, "invalid list command", "fields", fmt.Sprintf("%v", fields))
+		return Git{}, fmt.Errorf("invalid list command %v", fields)
+	}
+}
+
 // validOption ensures an option is properly formed. See SupportedOption() to
 // evaluate if an option is supported.
 func validOption(ctx context.Context, fields ...string) error {
 	// TODO: ideally we return a bool
 	// we should try to not make options fatal, but we may have to
 	// make an exception for force (or others).
-	if len(fields) != 3 {
+	if len(fields) < 3 {
 		slog.ErrorContext(ctx, "invalid number of arguments to option command",
 			"got", fmt.Sprintf("%d", len(fields)),
-			"want", "3")
+			"want", "at least 3")
 		return fmt.Errorf("invalid number of args to option command")
 	}
 	return nil
@@ -0,0 +1,28 @@
+#!/usr/bin/env bash
+# Generates markdown API documentation for the configuration types.
+# Usage: crd-ref-docs.sh <source path> <docs path>
+set -euo pipefail
+
+src="$1"
+out="$2"
+
+config="$(mktemp)"
+trap 'rm -f "$config"' EXIT
+cat > "$config" <<'YAML'
+processor:
+  ignoreTypes: []
+  ignoreFields: []
+render:
+  kubernetesVersion: 1.31
+YAML
+
+for dir in "$src"/*/*/; do
+  group="$(basename "$(dirname "$dir")")"
+  version="$(basename "$dir")"
+  mkdir -p "$out/$group"
+  go run github.com/elastic/crd-ref-docs@v0.3.0 \
+    --config "$config" \
+    --source-path "$dir" \
+    --renderer markdown \
+    --output-path "$out/$group/$version.md"
+done
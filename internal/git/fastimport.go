@@ -0,0 +1,840 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// Marks maps the marks of a fast-import stream, e.g. ":1", to object IDs.
+type Marks map[string]plumbing.Hash
+
+// ReadMarks reads a marks file, as written by git fast-export --export-marks.
+// A missing file results in empty marks.
+func ReadMarks(name string) (Marks, error) {
+	marks := make(Marks)
+	data, err := os.ReadFile(name)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return marks, nil
+	case err != nil:
+		return nil, fmt.Errorf("reading marks file: %w", err)
+	}
+
+	for line := range strings.SplitSeq(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		mark, oid, ok := strings.Cut(line, " ")
+		if !ok || !strings.HasPrefix(mark, ":") || !plumbing.IsHash(oid) {
+			return nil, fmt.Errorf("invalid line in marks file %s: %s", name, line)
+		}
+		marks[mark] = plumbing.NewHash(oid)
+	}
+	return marks, nil
+}
+
+// ImportStream reads a fast-import stream, e.g. from git fast-export, writing
+// its objects to st. Marks referenced, but not defined, by the stream are
+// resolved with marks. The references updated by the stream are returned in
+// the order they first appear, with their final values.
+//
+// See https://git-scm.com/docs/git-fast-import.
+func ImportStream(r io.Reader, st storer.EncodedObjectStorer, marks Marks) ([]*plumbing.Reference, error) {
+	imp := &importer{
+		r:     bufio.NewReader(r),
+		st:    st,
+		marks: maps.Clone(marks),
+		refs:  make(map[plumbing.ReferenceName]plumbing.Hash),
+	}
+	if imp.marks == nil {
+		imp.marks = make(Marks)
+	}
+
+	if err := imp.run(); err != nil {
+		return nil, err
+	}
+
+	result := make([]*plumbing.Reference, 0, len(imp.order))
+	for _, name := range imp.order {
+		result = append(result, plumbing.NewHashReference(name, imp.refs[name]))
+	}
+	return result, nil
+}
+
+// importer holds the state of a fast-import stream.
+type importer struct {
+	r     *bufio.Reader
+	st    storer.EncodedObjectStorer
+	marks Marks
+
+	// line is the current line, read but not yet handled
+	line    string
+	hasLine bool
+
+	// refs are the references updated by the stream
+	refs  map[plumbing.ReferenceName]plumbing.Hash
+	order []plumbing.ReferenceName
+
+	// files caches the flattened tree of the most recent commit, filesOf,
+	// as commits commonly build on the one before them
+	files   map[string]treeFile
+	filesOf plumbing.Hash
+}
+
+// treeFile is a non-directory entry of a flattened tree.
+type treeFile struct {
+	mode filemode.FileMode
+	hash plumbing.Hash
+}
+
+// run handles commands until the end of the stream or a 'done' command.
+func (imp *importer) run() error {
+	for {
+		line, err := imp.next()
+		switch {
+		case errors.Is(err, io.EOF):
+			return nil
+		case err != nil:
+			return err
+		}
+
+		cmd, arg, _ := strings.Cut(line, " ")
+		switch cmd {
+		case "":
+			// optional blank lines between commands
+		case "done":
+			return nil
+		case "blob":
+			err = imp.blob()
+		case "commit":
+			err = imp.commit(plumbing.ReferenceName(arg))
+		case "tag":
+			err = imp.tag(arg)
+		case "reset":
+			err = imp.reset(plumbing.ReferenceName(arg))
+		case "feature", "option", "progress", "checkpoint":
+			// no effect on the resulting objects
+		default:
+			err = fmt.Errorf("unsupported fast-import command: %s", line)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// blob handles a 'blob' command.
+func (imp *importer) blob() error {
+	mark, err := imp.optional("mark")
+	if err != nil {
+		return err
+	}
+	if _, err := imp.optional("original-oid"); err != nil {
+		return err
+	}
+
+	data, err := imp.data()
+	if err != nil {
+		return err
+	}
+
+	h, err := imp.write(plumbing.BlobObject, data)
+	if err != nil {
+		return err
+	}
+	imp.setMark(mark, h)
+	return nil
+}
+
+// commit handles a 'commit' command.
+func (imp *importer) commit(ref plumbing.ReferenceName) error {
+	mark, err := imp.optional("mark")
+	if err != nil {
+		return err
+	}
+	if _, err := imp.optional("original-oid"); err != nil {
+		return err
+	}
+	author, err := imp.optional("author")
+	if err != nil {
+		return err
+	}
+	committer, err := imp.optional("committer")
+	switch {
+	case err != nil:
+		return err
+	case committer == "":
+		return fmt.Errorf("commit to %s is missing a committer", ref)
+	case author == "":
+		author = committer
+	}
+	sigs, err := imp.signatures()
+	if err != nil {
+		return err
+	}
+	encoding, err := imp.optional("encoding")
+	if err != nil {
+		return err
+	}
+	msg, err := imp.data()
+	if err != nil {
+		return err
+	}
+	if err := imp.skipBlank(); err != nil {
+		return err
+	}
+
+	var parents []plumbing.Hash
+	from, err := imp.optional("from")
+	switch {
+	case err != nil:
+		return err
+	case from != "":
+		h, err := imp.resolve(from)
+		if err != nil {
+			return err
+		}
+		parents = append(parents, h)
+	default:
+		// without 'from', commits continue the history of the reference
+		if h, ok := imp.refs[ref]; ok && !h.IsZero() {
+			parents = append(parents, h)
+		}
+	}
+	for {
+		merge, err := imp.optional("merge")
+		if err != nil {
+			return err
+		}
+		if merge == "" {
+			break
+		}
+
+		h, err := imp.resolve(merge)
+		if err != nil {
+			return err
+		}
+		parents = append(parents, h)
+	}
+
+	files, err := imp.parentFiles(parents)
+	if err != nil {
+		return err
+	}
+	if err := imp.fileChanges(files); err != nil {
+		return err
+	}
+	tree, err := imp.writeTree(files)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "tree %s\n", tree)
+	for _, p := range parents {
+		fmt.Fprintf(&buf, "parent %s\n", p)
+	}
+	fmt.Fprintf(&buf, "author %s\ncommitter %s\n", author, committer)
+	if encoding != "" {
+		fmt.Fprintf(&buf, "encoding %s\n", encoding)
+	}
+	// as fast-import writes them, the signature of each object format once
+	for _, header := range []string{"gpgsig", "gpgsig-sha256"} {
+		if sig, ok := sigs[header]; ok {
+			writeHeader(&buf, header, sig)
+		}
+	}
+	buf.WriteString("\n")
+	buf.Write(msg)
+
+	h, err := imp.write(plumbing.CommitObject, buf.Bytes())
+	if err != nil {
+		return err
+	}
+	imp.setMark(mark, h)
+	imp.setRef(ref, h)
+
+	imp.files, imp.filesOf = files, h
+	return nil
+}
+
+// signatures reads the 'gpgsig' commands of a commit, written by
+// 'git fast-export --signed-commits', as gpgsig <algo> [<format>]. The
+// signatures are returned by the commit header they belong in.
+func (imp *importer) signatures() (map[string][]byte, error) {
+	sigs := make(map[string][]byte)
+	for {
+		arg, err := imp.optional("gpgsig")
+		switch {
+		case err != nil:
+			return nil, err
+		case arg == "":
+			return sigs, nil
+		}
+
+		var header string
+		switch algo, _, _ := strings.Cut(arg, " "); algo {
+		case "sha1":
+			header = "gpgsig"
+		case "sha256":
+			header = "gpgsig-sha256"
+		default:
+			return nil, fmt.Errorf("unsupported commit signature object format %s", algo)
+		}
+		sig, err := imp.data()
+		if err != nil {
+			return nil, err
+		}
+		sigs[header] = sig
+	}
+}
+
+// writeHeader writes a commit header whose value may span lines, continuing
+// each line after the first with a space.
+func writeHeader(buf *bytes.Buffer, name string, value []byte) {
+	buf.WriteString(name)
+	for line := range bytes.Lines(value) {
+		buf.WriteByte(' ')
+		buf.Write(line)
+	}
+	if len(value) == 0 || value[len(value)-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+}
+
+// tag handles a 'tag' command, creating an annotated tag.
+func (imp *importer) tag(name string) error {
+	mark, err := imp.optional("mark")
+	if err != nil {
+		return err
+	}
+	from, err := imp.optional("from")
+	switch {
+	case err != nil:
+		return err
+	case from == "":
+		return fmt.Errorf("tag %s is missing its target", name)
+	}
+	target, err := imp.resolve(from)
+	if err != nil {
+		return err
+	}
+	if _, err := imp.optional("original-oid"); err != nil {
+		return err
+	}
+	tagger, err := imp.optional("tagger")
+	if err != nil {
+		return err
+	}
+	msg, err := imp.data()
+	if err != nil {
+		return err
+	}
+
+	obj, err := imp.st.EncodedObject(plumbing.AnyObject, target)
+	if err != nil {
+		return fmt.Errorf("resolving target %s of tag %s: %w", target, name, err)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "object %s\ntype %s\ntag %s\n", target, obj.Type(), name)
+	if tagger != "" {
+		fmt.Fprintf(&buf, "tagger %s\n", tagger)
+	}
+	buf.WriteString("\n")
+	buf.Write(msg)
+
+	h, err := imp.write(plumbing.TagObject, buf.Bytes())
+	if err != nil {
+		return err
+	}
+	imp.setMark(mark, h)
+	imp.setRef(plumbing.NewTagReferenceName(name), h)
+	return nil
+}
+
+// reset handles a 'reset' command.
+func (imp *importer) reset(ref plumbing.ReferenceName) error {
+	from, err := imp.optional("from")
+	switch {
+	case err != nil:
+		return err
+	case from == "":
+		// the reference is recreated by a following commit
+		imp.setRef(ref, plumbing.ZeroHash)
+		return nil
+	}
+
+	h, err := imp.resolve(from)
+	if err != nil {
+		return err
+	}
+	imp.setRef(ref, h)
+	return nil
+}
+
+// fileChanges applies the file changes of a commit to files, until the end of
+// the commit.
+func (imp *importer) fileChanges(files map[string]treeFile) error {
+	for {
+		line, err := imp.next()
+		switch {
+		case errors.Is(err, io.EOF):
+			return nil
+		case err != nil:
+			return err
+		}
+
+		op, rest, _ := strings.Cut(line, " ")
+		switch op {
+		case "M":
+			err = imp.modify(files, rest)
+		case "D":
+			var p string
+			if p, err = unquotePath(rest); err == nil {
+				deletePath(files, p)
+			}
+		case "C", "R":
+			var src, dst string
+			if src, dst, err = splitPaths(rest); err == nil {
+				copyPath(files, src, dst)
+				if op == "R" {
+					deletePath(files, src)
+				}
+			}
+		case "deleteall":
+			clear(files)
+		default:
+			// end of the commit, a blank line or the next command
+			if line != "" {
+				imp.unread(line)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// modify handles a filemodify change, 'M <mode> <dataref> <path>'.
+func (imp *importer) modify(files map[string]treeFile, change string) error {
+	fields := strings.SplitN(change, " ", 3)
+	if len(fields) != 3 {
+		return fmt.Errorf("invalid file change: M %s", change)
+	}
+
+	mode, err := parseMode(fields[0])
+	if err != nil {
+		return err
+	}
+	p, err := unquotePath(fields[2])
+	if err != nil {
+		return err
+	}
+
+	var h plumbing.Hash
+	switch {
+	case fields[1] == "inline":
+		data, err := imp.data()
+		if err != nil {
+			return err
+		}
+		if h, err = imp.write(plumbing.BlobObject, data); err != nil {
+			return err
+		}
+	case mode == filemode.Submodule:
+		// commits of another repository, they don't exist in storage
+		if !plumbing.IsHash(fields[1]) {
+			return fmt.Errorf("invalid submodule commit %s for %s", fields[1], p)
+		}
+		h = plumbing.NewHash(fields[1])
+	default:
+		if h, err = imp.resolve(fields[1]); err != nil {
+			return err
+		}
+	}
+
+	// a file replaces a directory of the same name
+	deletePath(files, p)
+	files[p] = treeFile{mode: mode, hash: h}
+	return nil
+}
+
+// parentFiles returns the flattened tree of the first parent, empty if there
+// are no parents.
+func (imp *importer) parentFiles(parents []plumbing.Hash) (map[string]treeFile, error) {
+	files := make(map[string]treeFile)
+	if len(parents) == 0 {
+		return files, nil
+	}
+	if imp.files != nil && imp.filesOf == parents[0] {
+		return maps.Clone(imp.files), nil
+	}
+
+	commit, err := object.GetCommit(imp.st, parents[0])
+	if err != nil {
+		return nil, fmt.Errorf("resolving parent commit %s: %w", parents[0], err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("resolving tree of commit %s: %w", parents[0], err)
+	}
+
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		name, entry, err := walker.Next()
+		switch {
+		case errors.Is(err, io.EOF):
+			return files, nil
+		case err != nil:
+			return nil, fmt.Errorf("walking tree of commit %s: %w", parents[0], err)
+		case entry.Mode == filemode.Dir:
+			continue
+		}
+		files[name] = treeFile{mode: entry.Mode, hash: entry.Hash}
+	}
+}
+
+// writeTree writes the trees of a flattened tree, returning the root tree.
+func (imp *importer) writeTree(files map[string]treeFile) (plumbing.Hash, error) {
+	type dir struct {
+		files map[string]treeFile
+		dirs  map[string]bool
+	}
+
+	// group entries by their directory, creating all parent directories
+	dirs := map[string]*dir{"": {files: map[string]treeFile{}, dirs: map[string]bool{}}}
+	var ensure func(p string) *dir
+	ensure = func(p string) *dir {
+		if d, ok := dirs[p]; ok {
+			return d
+		}
+		d := &dir{files: map[string]treeFile{}, dirs: map[string]bool{}}
+		dirs[p] = d
+		parent := path.Dir(p)
+		if parent == "." {
+			parent = ""
+		}
+		ensure(parent).dirs[path.Base(p)] = true
+		return d
+	}
+	for p, f := range files {
+		parent := path.Dir(p)
+		if parent == "." {
+			parent = ""
+		}
+		ensure(parent).files[path.Base(p)] = f
+	}
+
+	var write func(p string) (plumbing.Hash, error)
+	write = func(p string) (plumbing.Hash, error) {
+		d := dirs[p]
+		tree := &object.Tree{}
+		for name, f := range d.files {
+			tree.Entries = append(tree.Entries, object.TreeEntry{Name: name, Mode: f.mode, Hash: f.hash})
+		}
+		for name := range d.dirs {
+			h, err := write(path.Join(p, name))
+			if err != nil {
+				return plumbing.ZeroHash, err
+			}
+			tree.Entries = append(tree.Entries, object.TreeEntry{Name: name, Mode: filemode.Dir, Hash: h})
+		}
+
+		// Git sorts directories as if their names end with '/'
+		slices.SortFunc(tree.Entries, func(a, b object.TreeEntry) int {
+			return strings.Compare(treeSortName(a), treeSortName(b))
+		})
+
+		obj := imp.st.NewEncodedObject()
+		if err := tree.Encode(obj); err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("encoding tree %s: %w", p, err)
+		}
+		h, err := imp.st.SetEncodedObject(obj)
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("writing tree %s: %w", p, err)
+		}
+		return h, nil
+	}
+	return write("")
+}
+
+// treeSortName returns the name a tree entry is sorted by.
+func treeSortName(e object.TreeEntry) string {
+	if e.Mode == filemode.Dir {
+		return e.Name + "/"
+	}
+	return e.Name
+}
+
+// data reads a 'data' command, in either its exact byte count or delimited
+// format.
+func (imp *importer) data() ([]byte, error) {
+	line, err := imp.next()
+	if err != nil {
+		return nil, fmt.Errorf("reading data: %w", err)
+	}
+	arg, ok := strings.CutPrefix(line, "data ")
+	if !ok {
+		return nil, fmt.Errorf("expected data, got: %s", line)
+	}
+
+	if delim, ok := strings.CutPrefix(arg, "<<"); ok {
+		var buf bytes.Buffer
+		for {
+			l, err := imp.r.ReadString('\n')
+			if err != nil {
+				return nil, fmt.Errorf("reading delimited data: %w", err)
+			}
+			if strings.TrimSuffix(l, "\n") == delim {
+				return buf.Bytes(), nil
+			}
+			buf.WriteString(l)
+		}
+	}
+
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid data length: %s", arg)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(imp.r, data); err != nil {
+		return nil, fmt.Errorf("reading data: %w", err)
+	}
+	return data, nil
+}
+
+// optional returns the argument of the current line if it is the named
+// command, otherwise the line is left to be handled by the caller.
+func (imp *importer) optional(name string) (string, error) {
+	line, err := imp.next()
+	switch {
+	case errors.Is(err, io.EOF):
+		return "", nil
+	case err != nil:
+		return "", err
+	}
+
+	arg, ok := strings.CutPrefix(line, name+" ")
+	if !ok {
+		imp.unread(line)
+		return "", nil
+	}
+	return arg, nil
+}
+
+// next returns the next line of the stream, skipping comments.
+func (imp *importer) next() (string, error) {
+	if imp.hasLine {
+		imp.hasLine = false
+		return imp.line, nil
+	}
+
+	for {
+		line, err := imp.r.ReadString('\n')
+		switch {
+		case errors.Is(err, io.EOF) && line == "":
+			return "", io.EOF
+		case err != nil && !errors.Is(err, io.EOF):
+			return "", fmt.Errorf("reading fast-import stream: %w", err)
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		if !strings.HasPrefix(line, "#") {
+			return line, nil
+		}
+	}
+}
+
+// skipBlank skips the optional blank line following data.
+func (imp *importer) skipBlank() error {
+	line, err := imp.next()
+	switch {
+	case errors.Is(err, io.EOF):
+		return nil
+	case err != nil:
+		return err
+	case line != "":
+		imp.unread(line)
+	}
+	return nil
+}
+
+// unread returns a line to be handled by the next call to next.
+func (imp *importer) unread(line string) {
+	imp.line, imp.hasLine = line, true
+}
+
+// resolve resolves a mark or object ID.
+func (imp *importer) resolve(ref string) (plumbing.Hash, error) {
+	if strings.HasPrefix(ref, ":") {
+		h, ok := imp.marks[ref]
+		if !ok {
+			return plumbing.ZeroHash, fmt.Errorf("unknown mark %s", ref)
+		}
+		return h, nil
+	}
+	if plumbing.IsHash(ref) {
+		return plumbing.NewHash(ref), nil
+	}
+	if h, ok := imp.refs[plumbing.ReferenceName(ref)]; ok {
+		return h, nil
+	}
+	return plumbing.ZeroHash, fmt.Errorf("unable to resolve %s", ref)
+}
+
+// write writes an object to storage.
+func (imp *importer) write(t plumbing.ObjectType, data []byte) (plumbing.Hash, error) {
+	obj := imp.st.NewEncodedObject()
+	obj.SetType(t)
+	obj.SetSize(int64(len(data)))
+	w, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("initializing %s writer: %w", t, err)
+	}
+	if _, err := w.Write(data); err != nil {
+		_ = w.Close()
+		return plumbing.ZeroHash, fmt.Errorf("writing %s: %w", t, err)
+	}
+	if err := w.Close(); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("writing %s: %w", t, err)
+	}
+
+	h, err := imp.st.SetEncodedObject(obj)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("storing %s: %w", t, err)
+	}
+	return h, nil
+}
+
+// setMark records the object of a mark, if any.
+func (imp *importer) setMark(mark string, h plumbing.Hash) {
+	if mark != "" {
+		imp.marks[mark] = h
+	}
+}
+
+// setRef records the value of a reference updated by the stream.
+func (imp *importer) setRef(name plumbing.ReferenceName, h plumbing.Hash) {
+	if _, ok := imp.refs[name]; !ok {
+		imp.order = append(imp.order, name)
+	}
+	imp.refs[name] = h
+}
+
+// parseMode parses the mode of a filemodify change, including the short
+// forms accepted by git fast-import.
+func parseMode(s string) (filemode.FileMode, error) {
+	switch s {
+	case "644":
+		return filemode.Regular, nil
+	case "755":
+		return filemode.Executable, nil
+	}
+
+	mode, err := filemode.New(s)
+	if err != nil {
+		return filemode.Empty, fmt.Errorf("invalid file mode %s: %w", s, err)
+	}
+	switch mode {
+	case filemode.Regular, filemode.Deprecated, filemode.Executable, filemode.Symlink, filemode.Submodule:
+		return mode, nil
+	default:
+		return filemode.Empty, fmt.Errorf("unsupported file mode %s", s)
+	}
+}
+
+// unquotePath unquotes a path, which is C-style quoted if it contains special
+// characters.
+func unquotePath(p string) (string, error) {
+	if !strings.HasPrefix(p, `"`) {
+		return p, nil
+	}
+	unquoted, err := strconv.Unquote(p)
+	if err != nil {
+		return "", fmt.Errorf("invalid quoted path %s: %w", p, err)
+	}
+	return unquoted, nil
+}
+
+// splitPaths splits the source and destination paths of a copy or rename.
+func splitPaths(s string) (string, string, error) {
+	var src, rest string
+	if strings.HasPrefix(s, `"`) {
+		// find the closing quote, skipping escaped characters
+		end := -1
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\\' {
+				i++
+				continue
+			}
+			if s[i] == '"' {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return "", "", fmt.Errorf("invalid quoted path %s", s)
+		}
+		src, rest = s[:end+1], strings.TrimPrefix(s[end+1:], " ")
+	} else {
+		var ok bool
+		if src, rest, ok = strings.Cut(s, " "); !ok {
+			return "", "", fmt.Errorf("missing destination path: %s", s)
+		}
+	}
+
+	src, err := unquotePath(src)
+	if err != nil {
+		return "", "", err
+	}
+	dst, err := unquotePath(rest)
+	if err != nil {
+		return "", "", err
+	}
+	return src, dst, nil
+}
+
+// deletePath removes a file, or directory, from a flattened tree.
+func deletePath(files map[string]treeFile, p string) {
+	delete(files, p)
+	prefix := p + "/"
+	for name := range files {
+		if strings.HasPrefix(name, prefix) {
+			delete(files, name)
+		}
+	}
+}
+
+// copyPath copies a file, or directory, within a flattened tree.
+func copyPath(files map[string]treeFile, src, dst string) {
+	copied := make(map[string]treeFile)
+	if f, ok := files[src]; ok {
+		copied[dst] = f
+	}
+	prefix := src + "/"
+	for name, f := range files {
+		if rest, ok := strings.CutPrefix(name, prefix); ok {
+			copied[path.Join(dst, rest)] = f
+		}
+	}
+
+	deletePath(files, dst)
+	maps.Copy(files, copied)
+}
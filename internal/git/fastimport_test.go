@@ -0,0 +1,228 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	format "github.com/go-git/go-git/v5/plumbing/format/config"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportStream(t *testing.T) {
+	// refs created by git fast-import from the same stream
+	const stream = `blob
+mark :1
+data 6
+hello
+
+commit refs/heads/main
+mark :2
+author A U Thor <author@example.com> 1700000000 +0000
+committer A U Thor <author@example.com> 1700000000 +0000
+data 5
+init
+M 100644 :1 "dir/a b.txt"
+M 100755 :1 run.sh
+
+commit refs/heads/main
+mark :3
+author A U Thor <author@example.com> 1700000100 +0100
+committer A U Thor <author@example.com> 1700000100 +0100
+data 7
+rename
+from :2
+R dir x
+D run.sh
+
+reset refs/tags/light
+from :2
+
+tag annotated
+from :3
+tagger A U Thor <author@example.com> 1700000200 +0000
+data 8
+release
+
+done
+`
+
+	st := memory.NewStorage()
+	got, err := ImportStream(strings.NewReader(stream), st, nil)
+	if err != nil {
+		t.Fatalf("ImportStream() error = %v", err)
+	}
+
+	// object IDs depend on the object format of the build
+	ids := map[format.ObjectFormat][3]string{
+		format.SHA1: {
+			"9157aac73eadb3b1a0527ea7171bb19c125679f1",
+			"6d6821d82784114dbba35fdff850be9e2204bc19",
+			"10e6f97cf2ad90290c7ea0cf8020dd9219d67c9f",
+		},
+		format.SHA256: {
+			"c39767d2bbc342db07645ec971de90fba27819817266ed7d9af6d54958a641a7",
+			"8700d05a29d29f050aee7d8c679eab17127ad2062d4bfe8714a30f0017737965",
+			"b10c7d790b73da37fe88ac77deceb87912a0c190e008e53e79989c012e46d1e6",
+		},
+	}[SupportedFormat]
+	want := []*plumbing.Reference{
+		plumbing.NewHashReference("refs/heads/main", plumbing.NewHash(ids[0])),
+		plumbing.NewHashReference("refs/tags/light", plumbing.NewHash(ids[1])),
+		plumbing.NewHashReference("refs/tags/annotated", plumbing.NewHash(ids[2])),
+	}
+	assert.Equal(t, want, got)
+}
+
+func TestImportStream_marks(t *testing.T) {
+	// the blob of an earlier export is referenced by mark
+	const stream = `commit refs/heads/main
+committer A U Thor <author@example.com> 1700000000 +0000
+data 5
+init
+M 100644 :1 a.txt
+
+done
+`
+
+	st := memory.NewStorage()
+	if _, err := ImportStream(strings.NewReader(stream), st, nil); err == nil {
+		t.Fatalf("ImportStream() expected error for unknown mark")
+	}
+
+	marks := Marks{":1": plumbing.ComputeHash(plumbing.BlobObject, []byte("hello\n"))}
+	got, err := ImportStream(strings.NewReader(stream), st, marks)
+	if err != nil {
+		t.Fatalf("ImportStream() error = %v", err)
+	}
+	assert.Len(t, got, 1)
+}
+
+func TestImportStream_signed(t *testing.T) {
+	const (
+		sig = "-----BEGIN PGP SIGNATURE-----\n\niQEzBAABCAAdFiEE\n-----END PGP SIGNATURE-----\n"
+		ssh = "-----BEGIN SSH SIGNATURE-----\nU1NIU0lH\n-----END SSH SIGNATURE-----\n"
+	)
+	blob := plumbing.ComputeHash(plumbing.BlobObject, []byte("hello\n"))
+	treeObj := &plumbing.MemoryObject{}
+	treeObj.SetType(plumbing.TreeObject)
+	if _, err := treeObj.Write([]byte("100644 a.txt\x00" + string(blob[:]))); err != nil {
+		t.Fatalf("writing tree: %v", err)
+	}
+
+	// the commit as Git writes it, signatures are indented continuation lines
+	original := "tree " + treeObj.Hash().String() + "\n" +
+		"author A U Thor <author@example.com> 1700000000 +0000\n" +
+		"committer A U Thor <author@example.com> 1700000000 +0000\n" +
+		"encoding ISO-8859-1\n" +
+		"gpgsig -----BEGIN PGP SIGNATURE-----\n \n iQEzBAABCAAdFiEE\n -----END PGP SIGNATURE-----\n" +
+		"gpgsig-sha256 -----BEGIN SSH SIGNATURE-----\n U1NIU0lH\n -----END SSH SIGNATURE-----\n" +
+		"\n" +
+		"caf\xe9\n"
+	want := plumbing.ComputeHash(plumbing.CommitObject, []byte(original))
+
+	var stream strings.Builder
+	stream.WriteString("blob\nmark :1\ndata 6\nhello\n\n")
+	stream.WriteString("commit refs/heads/main\nmark :2\n")
+	stream.WriteString("author A U Thor <author@example.com> 1700000000 +0000\n")
+	stream.WriteString("committer A U Thor <author@example.com> 1700000000 +0000\n")
+	fmt.Fprintf(&stream, "gpgsig sha1 openpgp\ndata %d\n%s", len(sig), sig)
+	// older versions of Git omit the signature format
+	fmt.Fprintf(&stream, "gpgsig sha256\ndata %d\n%s", len(ssh), ssh)
+	stream.WriteString("encoding ISO-8859-1\n")
+	stream.WriteString("data 5\ncaf\xe9\n")
+	stream.WriteString("M 100644 :1 a.txt\n\ndone\n")
+
+	st := memory.NewStorage()
+	got, err := ImportStream(strings.NewReader(stream.String()), st, nil)
+	if err != nil {
+		t.Fatalf("ImportStream() error = %v", err)
+	}
+	assert.Equal(t, []*plumbing.Reference{plumbing.NewHashReference("refs/heads/main", want)}, got)
+}
+
+func TestImportStream_roundTrip(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir := t.TempDir()
+	run := func(stdin string, args ...string) string {
+		t.Helper()
+
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		cmd.Env = append(os.Environ(),
+			"GIT_CONFIG_NOSYSTEM=1", "GIT_CONFIG_GLOBAL=/dev/null",
+			"GIT_AUTHOR_NAME=A U Thor", "GIT_AUTHOR_EMAIL=author@example.com",
+			"GIT_COMMITTER_NAME=A U Thor", "GIT_COMMITTER_EMAIL=author@example.com",
+			"GIT_AUTHOR_DATE=1700000000 +0000", "GIT_COMMITTER_DATE=1700000000 +0000")
+		cmd.Stdin = strings.NewReader(stdin)
+		var stderr strings.Builder
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, stderr.String())
+		}
+		return strings.TrimSpace(string(out))
+	}
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755); err != nil {
+			t.Fatalf("creating directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o755); err != nil {
+			t.Fatalf("writing %s: %v", name, err)
+		}
+	}
+
+	run("", "init", "-q", "-b", "main", "--object-format="+string(SupportedFormat))
+	write("a.txt", "hello\n")
+	write("dir/run.sh", "#!/bin/sh\n")
+	run("", "add", ".")
+	run("", "commit", "-q", "-m", "init")
+	run("", "checkout", "-q", "-b", "topic")
+	run("", "mv", "dir", "moved")
+	run("", "-c", "i18n.commitEncoding=ISO-8859-1", "commit", "-q", "-m", "caf\xe9")
+	run("", "checkout", "-q", "main")
+	write("b.txt", "world\n")
+	run("", "add", ".")
+	run("", "commit", "-q", "-m", "second")
+	run("", "merge", "-q", "--no-ff", "-m", "merge", "topic")
+	run("", "tag", "-a", "v1", "-m", "release")
+
+	// a signed commit, the signature need not verify to be preserved
+	head := run("", "cat-file", "commit", "HEAD")
+	header, msg, _ := strings.Cut(head, "\n\n")
+	signed := header + "\ngpgsig -----BEGIN PGP SIGNATURE-----\n \n iQEzBAABCAAdFiEE\n -----END PGP SIGNATURE-----\n\n" + msg + "\n"
+	run("", "update-ref", "refs/heads/signed", run(signed, "hash-object", "-t", "commit", "-w", "--stdin"))
+
+	refs := []string{"refs/heads/main", "refs/heads/topic", "refs/tags/v1"}
+	export := []string{"fast-export", "--all", "--reencode=no", "--signed-tags=verbatim", "--signed-commits=verbatim"}
+	cmd := exec.Command("git", append([]string{"-C", dir}, export...)...)
+	if err := cmd.Run(); err != nil {
+		// older versions of Git strip commit signatures
+		t.Logf("git fast-export does not support --signed-commits, skipping the signed commit")
+		export = export[:len(export)-1]
+	} else {
+		refs = append(refs, "refs/heads/signed")
+	}
+	stream := run("", export...)
+
+	st := memory.NewStorage()
+	got, err := ImportStream(strings.NewReader(stream+"\ndone\n"), st, nil)
+	if err != nil {
+		t.Fatalf("ImportStream() error = %v", err)
+	}
+	imported := make(map[string]string)
+	for _, ref := range got {
+		imported[ref.Name().String()] = ref.Hash().String()
+	}
+	for _, ref := range refs {
+		assert.Equal(t, run("", "rev-parse", ref), imported[ref], "object ID of %s", ref)
+	}
+}
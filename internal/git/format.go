@@ -0,0 +1,55 @@
+package git
+
+import (
+	"crypto"
+	"fmt"
+	"strings"
+
+	format "github.com/go-git/go-git/v5/plumbing/format/config"
+	"github.com/go-git/go-git/v5/plumbing/hash"
+	"github.com/go-git/go-git/v5/storage"
+)
+
+// SupportedFormat is the only object format this build can read or write.
+// go-git selects the hash algorithm of object IDs at compile time, SHA-256
+// requires building with the sha256 tag. Releases include a build of each.
+var SupportedFormat = supportedFormat()
+
+// FormatHint returns advice for handling a repository in object format f,
+// appended to errors of builds that don't support it.
+func FormatHint(f format.ObjectFormat) string {
+	switch {
+	case f == SupportedFormat:
+		return ""
+	case f == format.SHA256:
+		return ", use the sha256 build of git-remote-oci"
+	case f == format.SHA1:
+		return ", use the default build of git-remote-oci"
+	default:
+		return ""
+	}
+}
+
+// supportedFormat returns the object format of go-git's object IDs.
+func supportedFormat() format.ObjectFormat {
+	if hash.CryptoType == crypto.SHA256 {
+		return format.SHA256
+	}
+	return format.SHA1
+}
+
+// RepositoryFormat returns the object format of a local repository, as set by
+// its extensions.objectFormat config.
+func RepositoryFormat(st storage.Storer) (format.ObjectFormat, error) {
+	cfg, err := st.Config()
+	if err != nil {
+		return "", fmt.Errorf("reading repository config: %w", err)
+	}
+
+	// go-git doesn't decode extensions, only encodes them
+	f := cfg.Raw.Section("extensions").Option("objectformat")
+	if f == "" {
+		return format.DefaultObjectFormat, nil
+	}
+	return format.ObjectFormat(strings.ToLower(f)), nil
+}
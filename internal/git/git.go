@@ -0,0 +1,402 @@
+// Package git facilitates interactions with a local Git repository's object storage.
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/format/idxfile"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/revlist"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/go-git/go-git/v5/storage/filesystem/dotgit"
+)
+
+// Open opens the storage of a local Git repository, where gitDir is the
+// path to the .git directory. In a linked worktree, gitDir is
+// .git/worktrees/<name>, objects and shared references are stored in the
+// common directory it refers to.
+func Open(gitDir string) (*filesystem.Storage, error) {
+	if gitDir == "" {
+		return nil, fmt.Errorf("opening local repository: GIT_DIR not set")
+	}
+
+	fi, err := os.Stat(gitDir)
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("opening local repository: %w", err)
+	case !fi.IsDir():
+		return nil, fmt.Errorf("opening local repository: %s is not a directory", gitDir)
+	}
+
+	repoFS, err := repositoryFilesystem(gitDir)
+	if err != nil {
+		return nil, fmt.Errorf("opening local repository: %w", err)
+	}
+	return filesystem.NewStorage(repoFS, cache.NewObjectLRUDefault()), nil
+}
+
+// repositoryFilesystem returns the filesystem of a .git directory, resolving
+// the common directory named by its commondir file, if any.
+//
+// https://git-scm.com/docs/gitrepository-layout#Documentation/gitrepository-layout.txt-commondir
+func repositoryFilesystem(gitDir string) (billy.Filesystem, error) {
+	dot := osfs.New(gitDir)
+
+	b, err := os.ReadFile(filepath.Join(gitDir, "commondir"))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return dot, nil
+	case err != nil:
+		return nil, fmt.Errorf("reading commondir: %w", err)
+	}
+
+	commonDir := strings.TrimSpace(string(b))
+	if !filepath.IsAbs(commonDir) {
+		commonDir = filepath.Join(gitDir, commonDir)
+	}
+	if _, err := os.Stat(commonDir); err != nil {
+		return nil, fmt.Errorf("resolving commondir: %w", err)
+	}
+	return dotgit.NewRepositoryFilesystem(dot, osfs.New(commonDir)), nil
+}
+
+// HasObject returns true if an object exists in storage.
+func HasObject(st storer.EncodedObjectStorer, h plumbing.Hash) (bool, error) {
+	err := st.HasEncodedObject(h)
+	switch {
+	case errors.Is(err, plumbing.ErrObjectNotFound):
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("checking existence of object %s: %w", h, err)
+	default:
+		return true, nil
+	}
+}
+
+// indexMu serializes the creation and completion of packfile writers, which
+// update the packfile indexes of storage without synchronization.
+var indexMu sync.Mutex
+
+// IndexPack writes a packfile to storage, generating its index. Packfiles
+// may be written to the same storage concurrently.
+func IndexPack(st storer.PackfileWriter, r io.Reader) error {
+	indexMu.Lock()
+	w, err := st.PackfileWriter()
+	indexMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("initializing packfile writer: %w", err)
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		indexMu.Lock()
+		_ = w.Close()
+		indexMu.Unlock()
+		return fmt.Errorf("writing packfile: %w", err)
+	}
+
+	indexMu.Lock()
+	defer indexMu.Unlock()
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("indexing packfile: %w", err)
+	}
+
+	return nil
+}
+
+// SkipPack reads a packfile from r without storing it, stopping at the end of
+// the packfile rather than the end of r.
+func SkipPack(r io.Reader) error {
+	s := packfile.NewScanner(r)
+	_, count, err := s.Header()
+	if err != nil {
+		return fmt.Errorf("reading packfile header: %w", err)
+	}
+
+	for i := uint32(0); i < count; i++ {
+		if _, err := s.NextObjectHeader(); err != nil {
+			return fmt.Errorf("reading packfile object header: %w", err)
+		}
+		if _, _, err := s.NextObject(io.Discard); err != nil {
+			return fmt.Errorf("reading packfile object: %w", err)
+		}
+	}
+
+	if _, err := s.Checksum(); err != nil {
+		return fmt.Errorf("reading packfile checksum: %w", err)
+	}
+	return nil
+}
+
+// Objects returns the IDs of all objects in storage.
+func Objects(st storer.EncodedObjectStorer) ([]plumbing.Hash, error) {
+	iter, err := st.IterEncodedObjects(plumbing.AnyObject)
+	if err != nil {
+		return nil, fmt.Errorf("iterating objects: %w", err)
+	}
+
+	var objs []plumbing.Hash
+	err = iter.ForEach(func(obj plumbing.EncodedObject) error {
+		objs = append(objs, obj.Hash())
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("iterating objects: %w", err)
+	}
+	return objs, nil
+}
+
+// packWindow is the number of objects considered for delta compression.
+const packWindow = 10
+
+// ListObjects returns the objects reachable from want, excluding those
+// reachable from have. Objects in have that do not exist in storage are ignored.
+func ListObjects(st storer.EncodedObjectStorer, want, have []plumbing.Hash) ([]plumbing.Hash, error) {
+	objs, err := revlist.Objects(st, want, have)
+	if err != nil {
+		return nil, fmt.Errorf("resolving objects to pack: %w", err)
+	}
+	return objs, nil
+}
+
+// PackObjects writes a packfile containing the objects reachable from want,
+// excluding those reachable from have, returning the number of objects packed.
+// Objects in have that do not exist in storage are ignored.
+func PackObjects(w io.Writer, st storer.EncodedObjectStorer, want, have []plumbing.Hash) (int, error) {
+	objs, err := ListObjects(st, want, have)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(objs) == 0 {
+		return 0, nil
+	}
+
+	enc := packfile.NewEncoder(w, st, false)
+	if _, err := enc.Encode(objs, packWindow); err != nil {
+		return 0, fmt.Errorf("encoding packfile: %w", err)
+	}
+
+	return len(objs), nil
+}
+
+// IsCommit returns true if an object in storage is a commit.
+func IsCommit(st storer.EncodedObjectStorer, h plumbing.Hash) (bool, error) {
+	obj, err := st.EncodedObject(plumbing.AnyObject, h)
+	if err != nil {
+		return false, fmt.Errorf("resolving object %s: %w", h, err)
+	}
+	return obj.Type() == plumbing.CommitObject, nil
+}
+
+// Peel follows tag objects to the object they ultimately refer to. Objects
+// other than tags are returned as is.
+func Peel(st storer.EncodedObjectStorer, h plumbing.Hash) (plumbing.Hash, error) {
+	for {
+		obj, err := st.EncodedObject(plumbing.AnyObject, h)
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("resolving object %s: %w", h, err)
+		}
+		if obj.Type() != plumbing.TagObject {
+			return h, nil
+		}
+
+		tag, err := object.DecodeTag(st, obj)
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("decoding tag %s: %w", h, err)
+		}
+		h = tag.Target
+	}
+}
+
+// ResolveRef resolves a reference, following symbolic references, to the
+// object it points to.
+func ResolveRef(st storer.ReferenceStorer, name plumbing.ReferenceName) (plumbing.Hash, error) {
+	ref, err := storer.ResolveReference(st, name)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("resolving reference %s: %w", name, err)
+	}
+	return ref.Hash(), nil
+}
+
+// IsAncestor returns true if ancestor is reachable from commit. A commit is
+// considered to be its own ancestor.
+func IsAncestor(st storer.EncodedObjectStorer, ancestor, commit plumbing.Hash) (bool, error) {
+	if ancestor == commit {
+		return true, nil
+	}
+
+	a, err := object.GetCommit(st, ancestor)
+	if err != nil {
+		return false, fmt.Errorf("resolving commit %s: %w", ancestor, err)
+	}
+
+	c, err := object.GetCommit(st, commit)
+	if err != nil {
+		return false, fmt.Errorf("resolving commit %s: %w", commit, err)
+	}
+
+	ok, err := a.IsAncestor(c)
+	if err != nil {
+		return false, fmt.Errorf("walking history of commit %s: %w", commit, err)
+	}
+	return ok, nil
+}
+
+// IndexPackObjects writes a packfile to storage as IndexPack does, returning
+// the IDs of the objects it contains as recorded in its index.
+func IndexPackObjects(st *filesystem.Storage, r io.Reader) ([]plumbing.Hash, error) {
+	tr := &trailerReader{r: r}
+	if err := IndexPack(st, tr); err != nil {
+		return nil, err
+	}
+
+	// packfiles are named by their checksum, the trailer of the packfile
+	var checksum plumbing.Hash
+	copy(checksum[:], tr.trailer)
+	name := path.Join("objects", "pack", fmt.Sprintf("pack-%s.idx", checksum))
+
+	f, err := st.Filesystem().Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("opening packfile index: %w", err)
+	}
+	defer f.Close()
+
+	idx := idxfile.NewMemoryIndex()
+	if err := idxfile.NewDecoder(f).Decode(idx); err != nil {
+		return nil, fmt.Errorf("decoding packfile index: %w", err)
+	}
+
+	iter, err := idx.Entries()
+	if err != nil {
+		return nil, fmt.Errorf("iterating packfile index: %w", err)
+	}
+	defer iter.Close()
+
+	var objs []plumbing.Hash
+	for {
+		entry, err := iter.Next()
+		switch {
+		case errors.Is(err, io.EOF):
+			return objs, nil
+		case err != nil:
+			return nil, fmt.Errorf("iterating packfile index: %w", err)
+		}
+		objs = append(objs, entry.Hash)
+	}
+}
+
+// IndexPackTee indexes a packfile read from r into st as IndexPackObjects
+// does, copying it to w as it is read. Unlike IndexPackObjects it returns at
+// the end of the packfile rather than the end of r, e.g. a connection Git keeps
+// open for a response. Reads are buffered, so nothing may follow the packfile
+// until it is indexed.
+func IndexPackTee(st *filesystem.Storage, r io.Reader, w io.Writer) ([]plumbing.Hash, error) {
+	pr, pw := io.Pipe()
+	var objs []plumbing.Hash
+	var indexErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		objs, indexErr = IndexPackObjects(st, pr)
+		// stops the copy if indexing failed
+		pr.CloseWithError(indexErr)
+	}()
+
+	err := SkipPack(io.TeeReader(r, io.MultiWriter(w, pw)))
+	pw.CloseWithError(err)
+	<-done
+	switch {
+	case indexErr != nil:
+		return nil, indexErr
+	case err != nil:
+		return nil, err
+	}
+	return objs, nil
+}
+
+// trailerReader keeps the last len(plumbing.Hash) bytes read from r.
+type trailerReader struct {
+	r       io.Reader
+	trailer []byte
+}
+
+// Read implements io.Reader.
+func (t *trailerReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	t.trailer = append(t.trailer, p[:n]...)
+	if size := len(plumbing.ZeroHash); len(t.trailer) > size {
+		t.trailer = t.trailer[len(t.trailer)-size:]
+	}
+	return n, err //nolint:wrapcheck
+}
+
+// ReachableObjects returns the set of objects reachable from want.
+func ReachableObjects(st storer.EncodedObjectStorer, want []plumbing.Hash) (map[plumbing.Hash]struct{}, error) {
+	objs, err := revlist.Objects(st, want, nil)
+	if err != nil {
+		return nil, fmt.Errorf("resolving reachable objects: %w", err)
+	}
+
+	reachable := make(map[plumbing.Hash]struct{}, len(objs))
+	for _, h := range objs {
+		reachable[h] = struct{}{}
+	}
+	return reachable, nil
+}
+
+// Tips returns the commits and tags of objs that no other commit or tag of
+// objs refers to, i.e. those from which the history in objs can be walked.
+func Tips(st storer.EncodedObjectStorer, objs []plumbing.Hash) ([]plumbing.Hash, error) {
+	candidates := make(map[plumbing.Hash]bool)
+	var referred []plumbing.Hash
+	for _, h := range objs {
+		obj, err := st.EncodedObject(plumbing.AnyObject, h)
+		if err != nil {
+			return nil, fmt.Errorf("resolving object %s: %w", h, err)
+		}
+
+		switch obj.Type() {
+		case plumbing.CommitObject:
+			c, err := object.DecodeCommit(st, obj)
+			if err != nil {
+				return nil, fmt.Errorf("decoding commit %s: %w", h, err)
+			}
+			candidates[h] = true
+			referred = append(referred, c.ParentHashes...)
+		case plumbing.TagObject:
+			tag, err := object.DecodeTag(st, obj)
+			if err != nil {
+				return nil, fmt.Errorf("decoding tag %s: %w", h, err)
+			}
+			candidates[h] = true
+			referred = append(referred, tag.Target)
+		}
+	}
+
+	for _, h := range referred {
+		delete(candidates, h)
+	}
+
+	tips := make([]plumbing.Hash, 0, len(candidates))
+	for h := range candidates {
+		tips = append(tips, h)
+	}
+	slices.SortFunc(tips, func(a, b plumbing.Hash) int { return bytes.Compare(a[:], b[:]) })
+	return tips, nil
+}
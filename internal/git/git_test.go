@@ -0,0 +1,97 @@
+package git
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpen_linkedWorktree(t *testing.T) {
+	// .git and .git/worktrees/<name>, as created by git worktree add
+	commonDir := filepath.Join(t.TempDir(), ".git")
+	gitDir := filepath.Join(commonDir, "worktrees", "wt")
+	for _, d := range []string{filepath.Join(commonDir, "objects"), filepath.Join(commonDir, "refs"), gitDir} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatalf("creating repository: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(gitDir, "commondir"), []byte("../..\n"), 0o644); err != nil {
+		t.Fatalf("writing commondir: %v", err)
+	}
+
+	linked, err := Open(gitDir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	obj := linked.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	h, err := linked.SetEncodedObject(obj)
+	if err != nil {
+		t.Fatalf("SetEncodedObject() error = %v", err)
+	}
+	if err := linked.SetReference(plumbing.NewHashReference("refs/heads/main", h)); err != nil {
+		t.Fatalf("SetReference() error = %v", err)
+	}
+
+	// objects and references are shared with the main worktree
+	common, err := Open(commonDir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	exists, err := HasObject(common, h)
+	if err != nil {
+		t.Fatalf("HasObject() error = %v", err)
+	}
+	assert.True(t, exists)
+	ref, err := common.Reference("refs/heads/main")
+	if err != nil {
+		t.Fatalf("Reference() error = %v", err)
+	}
+	assert.Equal(t, h, ref.Hash())
+}
+
+func TestIndexPackTee(t *testing.T) {
+	src := memory.NewStorage()
+	obj := &plumbing.MemoryObject{}
+	obj.SetType(plumbing.BlobObject)
+	if _, err := obj.Write([]byte("hello\n")); err != nil {
+		t.Fatalf("writing blob: %v", err)
+	}
+	h, err := src.SetEncodedObject(obj)
+	if err != nil {
+		t.Fatalf("SetEncodedObject() error = %v", err)
+	}
+	var pack bytes.Buffer
+	if err := EncodePack(&pack, src, []plumbing.Hash{h}); err != nil {
+		t.Fatalf("EncodePack() error = %v", err)
+	}
+
+	// Git keeps the connection open for a response
+	pr, pw := io.Pipe()
+	t.Cleanup(func() { pw.Close() })
+	go func() {
+		_, _ = pw.Write(pack.Bytes())
+	}()
+	dir, st, err := InitTemp("git-remote-oci-test-*")
+	if err != nil {
+		t.Fatalf("InitTemp() error = %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	var copied bytes.Buffer
+	got, err := IndexPackTee(st, pr, &copied)
+	if err != nil {
+		t.Fatalf("IndexPackTee() error = %v", err)
+	}
+	assert.Equal(t, []plumbing.Hash{h}, got)
+	assert.Equal(t, pack.Bytes(), copied.Bytes())
+	if _, err := st.EncodedObject(plumbing.BlobObject, h); err != nil {
+		t.Errorf("EncodedObject() error = %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	format "github.com/go-git/go-git/v5/plumbing/format/config"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+// InitTemp creates a bare repository in the object format of the build in a
+// new temporary directory, named by pattern as in os.MkdirTemp, so git
+// commands can read the objects written to it. The caller removes the
+// directory.
+func InitTemp(pattern string) (string, *filesystem.Storage, error) {
+	dir, err := os.MkdirTemp("", pattern)
+	if err != nil {
+		return "", nil, fmt.Errorf("creating temporary repository: %w", err)
+	}
+
+	st := filesystem.NewStorage(osfs.New(dir), cache.NewObjectLRUDefault())
+	if err := initBare(st); err != nil {
+		_ = os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("initializing temporary repository: %w", err)
+	}
+	return dir, st, nil
+}
+
+// initBare initializes a bare repository in st, as git init --bare does.
+func initBare(st *filesystem.Storage) error {
+	if err := st.Init(); err != nil {
+		return fmt.Errorf("creating repository layout: %w", err)
+	}
+
+	cfg := config.NewConfig()
+	cfg.Core.IsBare = true
+	if SupportedFormat != format.SHA1 {
+		// https://git-scm.com/docs/repository-version
+		cfg.Core.RepositoryFormatVersion = format.Version_1
+		cfg.Extensions.ObjectFormat = SupportedFormat
+	}
+	if err := st.SetConfig(cfg); err != nil {
+		return fmt.Errorf("writing config: %w", err)
+	}
+
+	head := plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.Main)
+	if err := st.SetReference(head); err != nil {
+		return fmt.Errorf("writing HEAD: %w", err)
+	}
+	return nil
+}
+
+// gitEnv are the environment variables Git sets for a repository, which would
+// override the repository given to git commands.
+var gitEnv = []string{
+	"GIT_DIR", "GIT_WORK_TREE", "GIT_COMMON_DIR", "GIT_INDEX_FILE",
+	"GIT_OBJECT_DIRECTORY", "GIT_ALTERNATE_OBJECT_DIRECTORIES",
+}
+
+// WritePack writes a packfile containing objs, read from the repository at
+// gitDir, piped from git pack-objects. Unlike EncodePack, objects are streamed
+// rather than held in memory. Objects are listed in a canonical order and
+// packed by a single thread, so the same objects produce the same packfile.
+func WritePack(ctx context.Context, w io.Writer, gitDir string, objs []plumbing.Hash) error {
+	objs = slices.Clone(objs)
+	plumbing.HashesSort(objs)
+	var list strings.Builder
+	for _, h := range objs {
+		list.WriteString(h.String())
+		list.WriteByte('\n')
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "--git-dir="+gitDir, "pack-objects",
+		"--stdout", "--quiet", "--delta-base-offset", "--threads=1")
+	cmd.Env = slices.DeleteFunc(os.Environ(), func(kv string) bool {
+		name, _, _ := strings.Cut(kv, "=")
+		return slices.Contains(gitEnv, name)
+	})
+	cmd.Stdin = strings.NewReader(list.String())
+	cmd.Stdout = w
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git pack-objects: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return nil
+}
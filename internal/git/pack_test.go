@@ -0,0 +1,61 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWritePack(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir, st, err := InitTemp("git-remote-oci-test-*")
+	if err != nil {
+		t.Fatalf("InitTemp() error = %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	var objs []plumbing.Hash
+	for _, content := range []string{"hello\n", "hello, world\n"} {
+		obj := &plumbing.MemoryObject{}
+		obj.SetType(plumbing.BlobObject)
+		if _, err := obj.Write([]byte(content)); err != nil {
+			t.Fatalf("writing blob: %v", err)
+		}
+		h, err := st.SetEncodedObject(obj)
+		if err != nil {
+			t.Fatalf("SetEncodedObject() error = %v", err)
+		}
+		objs = append(objs, h)
+	}
+
+	var pack bytes.Buffer
+	if err := WritePack(context.Background(), &pack, dir, objs); err != nil {
+		t.Fatalf("WritePack() error = %v", err)
+	}
+
+	// the same objects, in any order, produce the same packfile
+	var again bytes.Buffer
+	if err := WritePack(context.Background(), &again, dir, []plumbing.Hash{objs[1], objs[0]}); err != nil {
+		t.Fatalf("WritePack() error = %v", err)
+	}
+	assert.Equal(t, pack.Bytes(), again.Bytes())
+
+	otherDir, other, err := InitTemp("git-remote-oci-test-*")
+	if err != nil {
+		t.Fatalf("InitTemp() error = %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(otherDir) })
+	got, err := IndexPackObjects(other, &pack)
+	if err != nil {
+		t.Fatalf("IndexPackObjects() error = %v", err)
+	}
+	assert.ElementsMatch(t, objs, got)
+}
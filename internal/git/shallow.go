@@ -0,0 +1,216 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// ShallowOptions limit the history included in a shallow fetch. Commits
+// must satisfy all limits to be included, the wanted commits are always included.
+type ShallowOptions struct {
+	// Depth is the number of commits, from the wanted commits, to include.
+	// Zero indicates no limit.
+	Depth int
+
+	// Since excludes commits with a committer date before it. A zero value
+	// indicates no limit.
+	Since time.Time
+
+	// Not excludes commits reachable from any of its commits.
+	Not []plumbing.Hash
+
+	// Relative counts Depth from Shallow, the shallow commits of the
+	// repository being deepened, as git fetch --deepen does. Depth is the
+	// number of commits to include beyond those reached from the wanted
+	// commits, the history between the wanted commits and them is included in
+	// full.
+	Relative bool
+	Shallow  []plumbing.Hash
+}
+
+// ShallowObjects resolves the objects reachable from want within the limits
+// of opts. The shallow commits are the included commits with excluded parents.
+// An error wrapping plumbing.ErrObjectNotFound is returned if st is missing
+// objects of the resolved history.
+func ShallowObjects(st storer.EncodedObjectStorer, want []plumbing.Hash, opts ShallowOptions) (objs, shallow []plumbing.Hash, err error) {
+	excluded, err := reachableCommits(st, opts.Not)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	type entry struct {
+		commit *object.Commit
+		depth  int
+
+		// limited is false for commits above the shallow commits being
+		// deepened, the depth is yet to be counted
+		limited bool
+	}
+
+	included := make(map[plumbing.Hash]*object.Commit)
+	objSet := make(map[plumbing.Hash]struct{})
+	queue := make([]entry, 0, len(want))
+	for _, h := range want {
+		commit, err := peelToCommit(st, h, objSet)
+		if err != nil {
+			return nil, nil, err
+		}
+		queue = append(queue, entry{commit: commit, limited: !opts.Relative})
+	}
+
+	// breadth first, so commits are included at their minimum depth
+	for len(queue) > 0 {
+		e := queue[0]
+		queue = queue[1:]
+		if _, ok := included[e.commit.Hash]; ok {
+			continue
+		}
+		included[e.commit.Hash] = e.commit
+
+		if !e.limited && slices.Contains(opts.Shallow, e.commit.Hash) {
+			// the shallow commit is already included, its parents are the
+			// first to count
+			e.depth, e.limited = -1, true
+		}
+		if opts.Depth > 0 && e.limited && e.depth+1 >= opts.Depth {
+			continue
+		}
+
+		for _, p := range e.commit.ParentHashes {
+			if _, ok := excluded[p]; ok {
+				continue
+			}
+
+			parent, err := object.GetCommit(st, p)
+			if err != nil {
+				return nil, nil, fmt.Errorf("resolving parent commit %s: %w", p, err)
+			}
+			if !opts.Since.IsZero() && parent.Committer.When.Before(opts.Since) {
+				continue
+			}
+			queue = append(queue, entry{commit: parent, depth: e.depth + 1, limited: e.limited})
+		}
+	}
+
+	for h, commit := range included {
+		objSet[h] = struct{}{}
+
+		tree, err := commit.Tree()
+		if err != nil {
+			return nil, nil, fmt.Errorf("resolving tree of commit %s: %w", h, err)
+		}
+		if err := treeObjects(st, tree, objSet); err != nil {
+			return nil, nil, err
+		}
+
+		for _, p := range commit.ParentHashes {
+			if _, ok := included[p]; !ok {
+				shallow = append(shallow, h)
+				break
+			}
+		}
+	}
+
+	objs = make([]plumbing.Hash, 0, len(objSet))
+	for h := range objSet {
+		objs = append(objs, h)
+	}
+
+	return objs, shallow, nil
+}
+
+// EncodePack writes a packfile containing objs. Objects are encoded in a
+// canonical order, so the same objects always produce the same packfile.
+func EncodePack(w io.Writer, st storer.EncodedObjectStorer, objs []plumbing.Hash) error {
+	objs = slices.Clone(objs)
+	plumbing.HashesSort(objs)
+
+	enc := packfile.NewEncoder(w, st, false)
+	if _, err := enc.Encode(objs, packWindow); err != nil {
+		return fmt.Errorf("encoding packfile: %w", err)
+	}
+	return nil
+}
+
+// peelToCommit resolves the commit an object refers to, adding any tag
+// objects encountered along the way to objs.
+func peelToCommit(st storer.EncodedObjectStorer, h plumbing.Hash, objs map[plumbing.Hash]struct{}) (*object.Commit, error) {
+	for {
+		obj, err := object.GetObject(st, h)
+		if err != nil {
+			return nil, fmt.Errorf("resolving object %s: %w", h, err)
+		}
+
+		switch o := obj.(type) {
+		case *object.Commit:
+			return o, nil
+		case *object.Tag:
+			objs[h] = struct{}{}
+			h = o.Target
+		default:
+			return nil, fmt.Errorf("object %s is a %s, expected a commit or tag", h, obj.Type())
+		}
+	}
+}
+
+// reachableCommits returns the set of commits reachable from commits.
+func reachableCommits(st storer.EncodedObjectStorer, commits []plumbing.Hash) (map[plumbing.Hash]bool, error) {
+	result := make(map[plumbing.Hash]bool)
+	for _, h := range commits {
+		commit, err := peelToCommit(st, h, make(map[plumbing.Hash]struct{}))
+		if err != nil {
+			return nil, err
+		}
+
+		iter := object.NewCommitPreorderIter(commit, result, nil)
+		err = iter.ForEach(func(c *object.Commit) error {
+			result[c.Hash] = true
+			return nil
+		})
+		if err != nil && !errors.Is(err, storer.ErrStop) {
+			return nil, fmt.Errorf("walking history of %s: %w", h, err)
+		}
+	}
+	return result, nil
+}
+
+// treeObjects adds the hashes of a tree and all of its subtrees and blobs to
+// objs, returning an error if any of them are missing from st.
+func treeObjects(st storer.EncodedObjectStorer, tree *object.Tree, objs map[plumbing.Hash]struct{}) error {
+	if _, ok := objs[tree.Hash]; ok {
+		return nil
+	}
+	objs[tree.Hash] = struct{}{}
+
+	for _, e := range tree.Entries {
+		switch e.Mode {
+		case filemode.Submodule:
+			// commits of another repository
+			continue
+		case filemode.Dir:
+			// not tree.Tree, which hides missing objects
+			subtree, err := object.GetTree(st, e.Hash)
+			if err != nil {
+				return fmt.Errorf("resolving tree %s: %w", e.Hash, err)
+			}
+			if err := treeObjects(st, subtree, objs); err != nil {
+				return err
+			}
+		default:
+			if err := st.HasEncodedObject(e.Hash); err != nil {
+				return fmt.Errorf("resolving blob %s: %w", e.Hash, err)
+			}
+			objs[e.Hash] = struct{}{}
+		}
+	}
+	return nil
+}
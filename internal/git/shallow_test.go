@@ -0,0 +1,127 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodePack(t *testing.T) {
+	const stream = `blob
+mark :1
+data 6
+hello
+
+blob
+mark :2
+data 6
+world
+
+commit refs/heads/main
+mark :3
+author A U Thor <author@example.com> 1700000000 +0000
+committer A U Thor <author@example.com> 1700000000 +0000
+data 5
+init
+M 100644 :1 a.txt
+M 100644 :2 b.txt
+
+done
+`
+
+	st := memory.NewStorage()
+	if _, err := ImportStream(strings.NewReader(stream), st, nil); err != nil {
+		t.Fatalf("ImportStream() error = %v", err)
+	}
+	objs, err := Objects(st)
+	if err != nil {
+		t.Fatalf("Objects() error = %v", err)
+	}
+
+	// the blobs have the same type and size, which otherwise leaves their
+	// order in the packfile to the order given
+	var first, second bytes.Buffer
+	if err := EncodePack(&first, st, objs); err != nil {
+		t.Fatalf("EncodePack() error = %v", err)
+	}
+	reversed := slices.Clone(objs)
+	slices.Reverse(reversed)
+	if err := EncodePack(&second, st, reversed); err != nil {
+		t.Fatalf("EncodePack() error = %v", err)
+	}
+	assert.Equal(t, first.Bytes(), second.Bytes())
+}
+
+func TestShallowObjects(t *testing.T) {
+	// a linear history of four commits, each adding a file
+	var stream strings.Builder
+	for i := 1; i <= 4; i++ {
+		fmt.Fprintf(&stream, "commit refs/heads/main\nmark :%d\n", i)
+		stream.WriteString("committer A U Thor <author@example.com> 1700000000 +0000\n")
+		fmt.Fprintf(&stream, "data 2\n%d\n", i)
+		fmt.Fprintf(&stream, "M 100644 inline %d.txt\ndata 2\n%d\n\n", i, i)
+		fmt.Fprintf(&stream, "reset refs/tags/c%d\nfrom :%d\n\n", i, i)
+	}
+	stream.WriteString("done\n")
+
+	st := memory.NewStorage()
+	refs, err := ImportStream(strings.NewReader(stream.String()), st, nil)
+	if err != nil {
+		t.Fatalf("ImportStream() error = %v", err)
+	}
+	c := make(map[string]plumbing.Hash)
+	for _, ref := range refs {
+		c[ref.Name().Short()] = ref.Hash()
+	}
+
+	tests := []struct {
+		name        string
+		opts        ShallowOptions
+		wantCommits []plumbing.Hash
+		wantShallow []plumbing.Hash
+	}{
+		{
+			name:        "Depth",
+			opts:        ShallowOptions{Depth: 2},
+			wantCommits: []plumbing.Hash{c["c4"], c["c3"]},
+			wantShallow: []plumbing.Hash{c["c3"]},
+		},
+		{
+			name:        "Relative",
+			opts:        ShallowOptions{Depth: 1, Relative: true, Shallow: []plumbing.Hash{c["c3"]}},
+			wantCommits: []plumbing.Hash{c["c4"], c["c3"], c["c2"]},
+			wantShallow: []plumbing.Hash{c["c2"]},
+		},
+		{
+			name:        "Relative Not Shallow",
+			opts:        ShallowOptions{Depth: 1, Relative: true},
+			wantCommits: []plumbing.Hash{c["c4"], c["c3"], c["c2"], c["c1"]},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objs, shallow, err := ShallowObjects(st, []plumbing.Hash{c["c4"]}, tt.opts)
+			if err != nil {
+				t.Fatalf("ShallowObjects() error = %v", err)
+			}
+			for _, h := range []plumbing.Hash{c["c1"], c["c2"], c["c3"], c["c4"]} {
+				assert.Equal(t, slices.Contains(tt.wantCommits, h), slices.Contains(objs, h), "commit %s", h)
+			}
+			assert.Equal(t, tt.wantShallow, shallow)
+		})
+	}
+
+	// objects of the resolved history are missing, e.g. in an older layer
+	blob := plumbing.ComputeHash(plumbing.BlobObject, []byte("1\n"))
+	delete(st.ObjectStorage.Objects, blob)
+	delete(st.ObjectStorage.Blobs, blob)
+	// the trees of later commits still hold the first file
+	_, _, err = ShallowObjects(st, []plumbing.Hash{c["c4"]}, ShallowOptions{Depth: 1})
+	assert.ErrorIs(t, err, plumbing.ErrObjectNotFound)
+}
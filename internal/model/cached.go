@@ -0,0 +1,46 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/act3-ai/gitoci/internal/cache"
+)
+
+// cachedModeler serves packfile layers from a local cache, see WithCache.
+type cachedModeler struct {
+	Modeler
+
+	cache *cache.Cache
+}
+
+// WithCache returns a Modeler that fetches packfile layers from a local cache
+// when possible, caching the layers it fetches from the remote. Layers are
+// immutable, so the cache is shared by all remotes.
+func WithCache(m Modeler, c *cache.Cache) Modeler {
+	return &cachedModeler{Modeler: m, cache: c}
+}
+
+// FetchLayer fetches a packfile layer. Layers missing from the cache, or
+// corrupt, are fetched from the remote.
+func (m *cachedModeler) FetchLayer(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+	rc, err := m.cache.Open(desc.Digest)
+	switch {
+	case err == nil:
+		slog.DebugContext(ctx, "using cached packfile layer", "layer", desc.Digest)
+		return rc, nil
+	case !errors.Is(err, fs.ErrNotExist):
+		slog.WarnContext(ctx, "ignoring packfile layer cache", "layer", desc.Digest, "error", err)
+	}
+
+	rc, err = m.Modeler.FetchLayer(ctx, desc)
+	if err != nil {
+		return nil, err
+	}
+	return m.cache.Tee(desc.Digest, desc.Size, rc), nil
+}
@@ -0,0 +1,506 @@
+// Package model facilitates interactions with Git repositories stored as OCI artifacts.
+package model
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/errdef"
+	"oras.land/oras-go/v2/registry"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	format "github.com/go-git/go-git/v5/plumbing/format/config"
+
+	"github.com/act3-ai/gitoci/internal/git"
+	"github.com/act3-ai/gitoci/pkg/oci"
+)
+
+// Error types.
+var (
+	// ErrConflict indicates the remote reference was modified after it was fetched.
+	ErrConflict = errors.New("remote reference modified concurrently")
+
+	// ErrObjectFormat indicates the remote uses an object format other than
+	// the one supported by this build, see git.SupportedFormat.
+	ErrObjectFormat = errors.New("unsupported object format")
+
+	// ErrUploadChanged indicates a layer differs from the interrupted upload
+	// it was to resume, in which case it must be uploaded again from the start.
+	ErrUploadChanged = errors.New("layer differs from interrupted upload")
+)
+
+// Modeler represents a Git repository stored in an OCI registry.
+type Modeler interface {
+	// Fetch fetches the manifest and config of the Git OCI artifact referenced
+	// by ref. An empty model is initialized if ref does not exist.
+	Fetch(ctx context.Context, ref string) (ocispec.Descriptor, error)
+
+	// Resolve resolves the descriptor of the manifest referenced by ref,
+	// without fetching it or its config. An empty descriptor is returned if
+	// ref does not exist.
+	Resolve(ctx context.Context, ref string) (ocispec.Descriptor, error)
+
+	// Config returns the Git OCI config. The returned config must not be modified.
+	Config() oci.ConfigGit
+
+	// Exists returns true if the fetched Git OCI artifact exists in the remote.
+	Exists() bool
+
+	// Layers returns the packfile layers of the Git OCI artifact, in the order
+	// they were pushed.
+	Layers() []ocispec.Descriptor
+
+	// FetchLayer fetches a packfile layer.
+	FetchLayer(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error)
+
+	// PushLayer pushes a packfile layer blob, skipping the upload if it
+	// already exists. See AddLayers to include it in the manifest.
+	PushLayer(ctx context.Context, desc ocispec.Descriptor, r io.Reader) error
+
+	// PushLayerStream pushes a packfile layer blob read from r, without
+	// knowing its size or digest in advance, returning its descriptor. At
+	// most one chunk of the layer is buffered in memory, see
+	// PushLayerChunked to resume interrupted uploads. See AddLayers to
+	// include it in the manifest.
+	PushLayerStream(ctx context.Context, r io.Reader) (ocispec.Descriptor, error)
+
+	// PushLayerChunked pushes a packfile layer blob read from r, without
+	// knowing its size or digest in advance, uploading it in sized chunks so
+	// an interrupted upload may be resumed.
+	PushLayerChunked(ctx context.Context, r io.Reader, opts ChunkedUpload) (ocispec.Descriptor, error)
+
+	// AddLayers appends pushed packfile layers to the layers of the manifest.
+	// The updated manifest is not pushed until Push is called.
+	AddLayers(descs ...ocispec.Descriptor)
+
+	// SetLayers replaces the layers of the manifest with pushed packfile
+	// layers. The updated manifest is not pushed until Push is called.
+	SetLayers(descs ...ocispec.Descriptor)
+
+	// Manifest returns the descriptor of the manifest, as fetched or most
+	// recently pushed. It is empty if the manifest does not exist.
+	Manifest() ocispec.Descriptor
+
+	// UpdateRef updates a reference in the config. The updated config is not
+	// pushed until Push is called.
+	UpdateRef(name plumbing.ReferenceName, info oci.ReferenceInfo) error
+
+	// RemoveRef removes a reference from the config, unsetting the remote HEAD
+	// if it refers to the reference. The updated config is not pushed until
+	// Push is called.
+	RemoveRef(name plumbing.ReferenceName)
+
+	// SetHead sets the branch the remote HEAD refers to, which must be a head
+	// in the config. The updated config is not pushed until Push is called.
+	SetHead(name plumbing.ReferenceName) error
+
+	// Push pushes the config and manifest, tagging the manifest with ref.
+	// ErrConflict is returned if ref no longer refers to the fetched manifest,
+	// in which case the model should be fetched again.
+	Push(ctx context.Context, ref string, annotations map[string]string) (ocispec.Descriptor, error)
+
+	// PushCert pushes a push certificate as an artifact referring to the
+	// manifest, as fetched or most recently pushed.
+	PushCert(ctx context.Context, cert []byte) (ocispec.Descriptor, error)
+
+	// PushCerts fetches the push certificates referring to the manifest, as
+	// fetched or most recently pushed.
+	PushCerts(ctx context.Context) ([][]byte, error)
+
+	// DeleteManifest deletes a manifest other than the current one by digest,
+	// e.g. one replaced by compaction. Blobs it referred to are left for the
+	// registry to garbage collect.
+	DeleteManifest(ctx context.Context, dgst digest.Digest) error
+}
+
+// model implements Modeler.
+type model struct {
+	target oras.GraphTarget
+
+	// populated by Fetch
+	manDesc ocispec.Descriptor
+	man     ocispec.Manifest
+	cfg     oci.ConfigGit
+}
+
+// NewModeler returns a Modeler backed by an OCI target.
+func NewModeler(target oras.GraphTarget) Modeler {
+	return &model{
+		target: target,
+		cfg:    emptyConfig(),
+	}
+}
+
+// Fetch fetches the manifest and config of the Git OCI artifact referenced
+// by ref. An empty model is initialized if ref does not exist.
+func (m *model) Fetch(ctx context.Context, ref string) (ocispec.Descriptor, error) {
+	manDesc, manBytes, err := oras.FetchBytes(ctx, m.target, ref, oras.DefaultFetchBytesOptions)
+	switch {
+	case errors.Is(err, errdef.ErrNotFound):
+		slog.DebugContext(ctx, "remote reference does not exist, initializing empty model", "reference", ref)
+		m.manDesc = ocispec.Descriptor{}
+		m.man = ocispec.Manifest{}
+		m.cfg = emptyConfig()
+		return ocispec.Descriptor{}, nil
+	case err != nil:
+		return ocispec.Descriptor{}, fmt.Errorf("fetching manifest %s: %w", ref, err)
+	}
+
+	var man ocispec.Manifest
+	if err := json.Unmarshal(manBytes, &man); err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("decoding manifest: %w", err)
+	}
+
+	if man.Config.MediaType != oci.MediaTypeGitConfig {
+		return ocispec.Descriptor{}, fmt.Errorf("unexpected config media type %s, expected %s", man.Config.MediaType, oci.MediaTypeGitConfig)
+	}
+
+	cfgBytes, err := content.FetchAll(ctx, m.target, man.Config)
+	if err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("fetching config: %w", err)
+	}
+
+	// object IDs of another format can't be decoded
+	var objFormat struct {
+		ObjectFormat format.ObjectFormat `json:"objectFormat"`
+	}
+	if err := json.Unmarshal(cfgBytes, &objFormat); err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("decoding config: %w", err)
+	}
+	if objFormat.ObjectFormat == "" {
+		// configs written before object formats were recorded
+		objFormat.ObjectFormat = format.SHA1
+	}
+	if objFormat.ObjectFormat != git.SupportedFormat {
+		return ocispec.Descriptor{}, fmt.Errorf("%w: remote uses %s, expected %s%s", ErrObjectFormat, objFormat.ObjectFormat, git.SupportedFormat, git.FormatHint(objFormat.ObjectFormat))
+	}
+
+	cfg := emptyConfig()
+	if err := json.Unmarshal(cfgBytes, &cfg); err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("decoding config: %w", err)
+	}
+	cfg.ObjectFormat = objFormat.ObjectFormat
+
+	// tolerate configs with missing fields
+	if cfg.Heads == nil {
+		cfg.Heads = make(map[plumbing.ReferenceName]oci.ReferenceInfo)
+	}
+	if cfg.Tags == nil {
+		cfg.Tags = make(map[plumbing.ReferenceName]oci.ReferenceInfo)
+	}
+	if cfg.Refs == nil {
+		cfg.Refs = make(map[plumbing.ReferenceName]oci.ReferenceInfo)
+	}
+
+	m.manDesc = manDesc
+	m.man = man
+	m.cfg = cfg
+
+	return manDesc, nil
+}
+
+// Resolve resolves the descriptor of the manifest referenced by ref,
+// without fetching it or its config. An empty descriptor is returned if ref
+// does not exist.
+func (m *model) Resolve(ctx context.Context, ref string) (ocispec.Descriptor, error) {
+	desc, err := m.target.Resolve(ctx, ref)
+	switch {
+	case errors.Is(err, errdef.ErrNotFound):
+		return ocispec.Descriptor{}, nil
+	case err != nil:
+		return ocispec.Descriptor{}, fmt.Errorf("resolving manifest %s: %w", ref, err)
+	}
+	return desc, nil
+}
+
+// Config returns the Git OCI config.
+func (m *model) Config() oci.ConfigGit {
+	return m.cfg
+}
+
+// Exists returns true if the fetched Git OCI artifact exists in the remote.
+func (m *model) Exists() bool {
+	return m.manDesc.Digest != ""
+}
+
+// Layers returns the packfile layers of the Git OCI artifact, in the order
+// they were pushed.
+func (m *model) Layers() []ocispec.Descriptor {
+	return m.man.Layers
+}
+
+// FetchLayer fetches a packfile layer.
+func (m *model) FetchLayer(ctx context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+	if desc.MediaType != oci.MediaTypePackLayer {
+		return nil, fmt.Errorf("unexpected layer media type %s, expected %s", desc.MediaType, oci.MediaTypePackLayer)
+	}
+
+	rc, err := m.target.Fetch(ctx, desc)
+	if err != nil {
+		return nil, fmt.Errorf("fetching layer %s: %w", desc.Digest, err)
+	}
+	return rc, nil
+}
+
+// PushLayer pushes a packfile layer blob, skipping the upload if it
+// already exists. See AddLayers to include it in the manifest.
+func (m *model) PushLayer(ctx context.Context, desc ocispec.Descriptor, r io.Reader) error {
+	if desc.MediaType != oci.MediaTypePackLayer {
+		return fmt.Errorf("unexpected layer media type %s, expected %s", desc.MediaType, oci.MediaTypePackLayer)
+	}
+
+	exists, err := m.target.Exists(ctx, desc)
+	if err != nil {
+		return fmt.Errorf("checking existence of layer %s: %w", desc.Digest, err)
+	}
+
+	if !exists {
+		if err := m.target.Push(ctx, desc, r); err != nil && !errors.Is(err, errdef.ErrAlreadyExists) {
+			return fmt.Errorf("pushing layer %s: %w", desc.Digest, err)
+		}
+	}
+
+	return nil
+}
+
+// AddLayers appends pushed packfile layers to the layers of the manifest.
+// The updated manifest is not pushed until Push is called.
+func (m *model) AddLayers(descs ...ocispec.Descriptor) {
+	m.man.Layers = append(m.man.Layers, descs...)
+}
+
+// SetLayers replaces the layers of the manifest with pushed packfile
+// layers. The updated manifest is not pushed until Push is called.
+func (m *model) SetLayers(descs ...ocispec.Descriptor) {
+	m.man.Layers = descs
+}
+
+// Manifest returns the descriptor of the manifest, as fetched or most
+// recently pushed. It is empty if the manifest does not exist.
+func (m *model) Manifest() ocispec.Descriptor {
+	return m.manDesc
+}
+
+// UpdateRef updates a reference in the config. The updated config is not
+// pushed until Push is called.
+func (m *model) UpdateRef(name plumbing.ReferenceName, info oci.ReferenceInfo) error {
+	switch {
+	case name.IsBranch():
+		m.cfg.Heads[name] = info
+	case name.IsTag():
+		m.cfg.Tags[name] = info
+	case strings.HasPrefix(name.String(), "refs/"):
+		m.cfg.Refs[name] = info
+	default:
+		return fmt.Errorf("unsupported reference %s, expected a name beginning with refs/", name)
+	}
+	return nil
+}
+
+// RemoveRef removes a reference from the config, unsetting the remote HEAD
+// if it refers to the reference. The updated config is not pushed until
+// Push is called.
+func (m *model) RemoveRef(name plumbing.ReferenceName) {
+	delete(m.cfg.Heads, name)
+	delete(m.cfg.Tags, name)
+	delete(m.cfg.Refs, name)
+	if m.cfg.Head == name {
+		m.cfg.Head = ""
+	}
+}
+
+// SetHead sets the branch the remote HEAD refers to, which must be a head
+// in the config. The updated config is not pushed until Push is called.
+func (m *model) SetHead(name plumbing.ReferenceName) error {
+	if _, ok := m.cfg.Heads[name]; !ok {
+		return fmt.Errorf("setting HEAD: branch %s not found in remote", name)
+	}
+	m.cfg.Head = name
+	return nil
+}
+
+// Push pushes the config and manifest, tagging the manifest with ref.
+// ErrConflict is returned if ref no longer refers to the fetched manifest,
+// in which case the model should be fetched again.
+func (m *model) Push(ctx context.Context, ref string, annotations map[string]string) (ocispec.Descriptor, error) {
+	cfgBytes, err := json.Marshal(m.cfg)
+	if err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("encoding config: %w", err)
+	}
+
+	cfgDesc := content.NewDescriptorFromBytes(oci.MediaTypeGitConfig, cfgBytes)
+	if err := m.target.Push(ctx, cfgDesc, bytes.NewReader(cfgBytes)); err != nil && !errors.Is(err, errdef.ErrAlreadyExists) {
+		return ocispec.Descriptor{}, fmt.Errorf("pushing config: %w", err)
+	}
+
+	opts := oras.PackManifestOptions{
+		Layers:              m.man.Layers,
+		ConfigDescriptor:    &cfgDesc,
+		ManifestAnnotations: annotations,
+	}
+	manDesc, err := oras.PackManifest(ctx, m.target, oras.PackManifestVersion1_1, oci.ArtifactTypeGitManifest, opts)
+	if err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("pushing manifest: %w", err)
+	}
+
+	// OCI registries do not support conditional tagging, so we narrow the
+	// window for lost updates as much as we can
+	if err := m.checkUnmodified(ctx, ref); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	if err := m.target.Tag(ctx, manDesc, ref); err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("tagging manifest %s: %w", ref, err)
+	}
+
+	m.manDesc = manDesc
+	m.man.Config = cfgDesc
+	m.man.Annotations = annotations
+
+	return manDesc, nil
+}
+
+// PushCert pushes a push certificate as an artifact referring to the
+// manifest, as fetched or most recently pushed.
+func (m *model) PushCert(ctx context.Context, cert []byte) (ocispec.Descriptor, error) {
+	if m.manDesc.Digest == "" {
+		return ocispec.Descriptor{}, errors.New("pushing push certificate: remote manifest does not exist")
+	}
+
+	certDesc := content.NewDescriptorFromBytes(oci.MediaTypePushCert, cert)
+	if err := m.target.Push(ctx, certDesc, bytes.NewReader(cert)); err != nil && !errors.Is(err, errdef.ErrAlreadyExists) {
+		return ocispec.Descriptor{}, fmt.Errorf("pushing push certificate: %w", err)
+	}
+
+	opts := oras.PackManifestOptions{
+		Subject: &m.manDesc,
+		Layers:  []ocispec.Descriptor{certDesc},
+	}
+	desc, err := oras.PackManifest(ctx, m.target, oras.PackManifestVersion1_1, oci.ArtifactTypePushCert, opts)
+	if err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("pushing push certificate manifest: %w", err)
+	}
+	return desc, nil
+}
+
+// PushCerts fetches the push certificates referring to the manifest, as
+// fetched or most recently pushed.
+func (m *model) PushCerts(ctx context.Context) ([][]byte, error) {
+	if m.manDesc.Digest == "" {
+		return nil, nil
+	}
+
+	referrers, err := registry.Referrers(ctx, m.target, m.manDesc, oci.ArtifactTypePushCert)
+	if err != nil {
+		return nil, fmt.Errorf("resolving push certificates: %w", err)
+	}
+
+	certs := make([][]byte, 0, len(referrers))
+	for _, desc := range referrers {
+		manBytes, err := content.FetchAll(ctx, m.target, desc)
+		if err != nil {
+			return nil, fmt.Errorf("fetching push certificate manifest %s: %w", desc.Digest, err)
+		}
+		var man ocispec.Manifest
+		if err := json.Unmarshal(manBytes, &man); err != nil {
+			return nil, fmt.Errorf("decoding push certificate manifest %s: %w", desc.Digest, err)
+		}
+
+		for _, layer := range man.Layers {
+			if layer.MediaType != oci.MediaTypePushCert {
+				continue
+			}
+			cert, err := content.FetchAll(ctx, m.target, layer)
+			if err != nil {
+				return nil, fmt.Errorf("fetching push certificate %s: %w", layer.Digest, err)
+			}
+			certs = append(certs, cert)
+		}
+	}
+	return certs, nil
+}
+
+// DeleteManifest deletes a manifest other than the current one by digest,
+// e.g. one replaced by compaction. Blobs it referred to are left for the
+// registry to garbage collect.
+func (m *model) DeleteManifest(ctx context.Context, dgst digest.Digest) error {
+	if dgst == m.manDesc.Digest {
+		return fmt.Errorf("refusing to delete current manifest %s", dgst)
+	}
+
+	deleter, ok := m.target.(content.Deleter)
+	if !ok {
+		return fmt.Errorf("deleting manifest %s: target does not support deletion", dgst)
+	}
+
+	desc, err := m.target.Resolve(ctx, dgst.String())
+	if err != nil {
+		return fmt.Errorf("resolving manifest %s: %w", dgst, err)
+	}
+	if err := m.checkGitManifest(ctx, desc); err != nil {
+		return err
+	}
+
+	if err := deleter.Delete(ctx, desc); err != nil {
+		return fmt.Errorf("deleting manifest %s: %w", dgst, err)
+	}
+	return nil
+}
+
+// checkGitManifest ensures desc refers to a Git OCI manifest, so unrelated
+// artifacts sharing the repository are never deleted.
+func (m *model) checkGitManifest(ctx context.Context, desc ocispec.Descriptor) error {
+	manBytes, err := content.FetchAll(ctx, m.target, desc)
+	if err != nil {
+		return fmt.Errorf("fetching manifest %s: %w", desc.Digest, err)
+	}
+
+	var man ocispec.Manifest
+	if err := json.Unmarshal(manBytes, &man); err != nil {
+		return fmt.Errorf("decoding manifest %s: %w", desc.Digest, err)
+	}
+	if man.ArtifactType != oci.ArtifactTypeGitManifest {
+		return fmt.Errorf("refusing to delete manifest %s: not a Git manifest", desc.Digest)
+	}
+	return nil
+}
+
+// checkUnmodified ensures ref still refers to the fetched manifest, returning
+// ErrConflict if it does not.
+func (m *model) checkUnmodified(ctx context.Context, ref string) error {
+	desc, err := m.target.Resolve(ctx, ref)
+	switch {
+	case errors.Is(err, errdef.ErrNotFound):
+		desc = ocispec.Descriptor{}
+	case err != nil:
+		return fmt.Errorf("resolving remote reference %s: %w", ref, err)
+	}
+
+	if desc.Digest != m.manDesc.Digest {
+		slog.DebugContext(ctx, "remote reference modified concurrently", "reference", ref,
+			"fetched", m.manDesc.Digest, "current", desc.Digest)
+		return fmt.Errorf("%w: %s", ErrConflict, ref)
+	}
+	return nil
+}
+
+// emptyConfig returns an initialized Git OCI config without any references,
+// recording the object format supported by this build.
+func emptyConfig() oci.ConfigGit {
+	return oci.ConfigGit{
+		ObjectFormat: git.SupportedFormat,
+		Heads:        make(map[plumbing.ReferenceName]oci.ReferenceInfo),
+		Tags:         make(map[plumbing.ReferenceName]oci.ReferenceInfo),
+		Refs:         make(map[plumbing.ReferenceName]oci.ReferenceInfo),
+	}
+}
@@ -0,0 +1,175 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/content/memory"
+	ocistore "oras.land/oras-go/v2/content/oci"
+
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/act3-ai/gitoci/internal/cache"
+	"github.com/act3-ai/gitoci/pkg/oci"
+)
+
+func Test_model_Push(t *testing.T) {
+	ctx := context.Background()
+	const ref = "v1"
+
+	store := memory.New()
+	layer := []byte("PACK")
+	layerDesc := content.NewDescriptorFromBytes(oci.MediaTypePackLayer, layer)
+	main := plumbing.NewHash("2f5bc3b4ea8aa6a1e0ef4c3d9fdf3ea1a3a1e2c4")
+
+	// both clients start from a nonexistent remote
+	first, second := NewModeler(store), NewModeler(store)
+	for _, m := range []Modeler{first, second} {
+		if _, err := m.Fetch(ctx, ref); err != nil {
+			t.Fatalf("Fetch() error = %v", err)
+		}
+		assert.False(t, m.Exists())
+	}
+
+	if err := first.PushLayer(ctx, layerDesc, bytes.NewReader(layer)); err != nil {
+		t.Fatalf("PushLayer() error = %v", err)
+	}
+	first.AddLayers(layerDesc)
+	if err := first.UpdateRef(plumbing.NewBranchReferenceName("main"), oci.ReferenceInfo{Commit: main, Layer: layerDesc.Digest}); err != nil {
+		t.Fatalf("UpdateRef() error = %v", err)
+	}
+	if _, err := first.Push(ctx, ref, nil); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+
+	// the second client's view of the remote is stale
+	_, err := second.Push(ctx, ref, nil)
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("Push() error = %v, want %v", err, ErrConflict)
+	}
+
+	if _, err := second.Fetch(ctx, ref); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	assert.True(t, second.Exists())
+	assert.Equal(t, []ocispec.Descriptor{layerDesc}, second.Layers())
+	assert.Equal(t, main, second.Config().Heads[plumbing.NewBranchReferenceName("main")].Commit)
+}
+
+func Test_model_PushCert(t *testing.T) {
+	ctx := context.Background()
+	const ref = "v1"
+
+	m := NewModeler(memory.New())
+	if _, err := m.Fetch(ctx, ref); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+
+	cert := []byte("certificate version 0.1\n")
+	if _, err := m.PushCert(ctx, cert); err == nil {
+		t.Fatalf("PushCert() expected error for nonexistent manifest")
+	}
+
+	if _, err := m.Push(ctx, ref, nil); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	if _, err := m.PushCert(ctx, cert); err != nil {
+		t.Fatalf("PushCert() error = %v", err)
+	}
+
+	certs, err := m.PushCerts(ctx)
+	if err != nil {
+		t.Fatalf("PushCerts() error = %v", err)
+	}
+	assert.Equal(t, [][]byte{cert}, certs)
+}
+
+func Test_model_DeleteManifest(t *testing.T) {
+	ctx := context.Background()
+	const ref = "v1"
+
+	store, err := ocistore.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	m := NewModeler(store)
+	if _, err := m.Fetch(ctx, ref); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+
+	prev, err := m.Push(ctx, ref, nil)
+	if err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	if _, err := m.Push(ctx, ref, map[string]string{"replaced": "true"}); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+
+	if err := m.DeleteManifest(ctx, m.Manifest().Digest); err == nil {
+		t.Fatalf("DeleteManifest() expected error for current manifest")
+	}
+	if err := m.DeleteManifest(ctx, prev.Digest); err != nil {
+		t.Fatalf("DeleteManifest() error = %v", err)
+	}
+
+	exists, err := store.Exists(ctx, prev)
+	if err != nil {
+		t.Fatalf("Exists() error = %v", err)
+	}
+	assert.False(t, exists)
+}
+
+func Test_cachedModeler_FetchLayer(t *testing.T) {
+	ctx := context.Background()
+
+	store := memory.New()
+	layer := []byte("PACK")
+	layerDesc := content.NewDescriptorFromBytes(oci.MediaTypePackLayer, layer)
+	if err := store.Push(ctx, layerDesc, bytes.NewReader(layer)); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+
+	dir := t.TempDir()
+	c, err := cache.New(dir, 1<<20)
+	if err != nil {
+		t.Fatalf("cache.New() error = %v", err)
+	}
+	m := WithCache(NewModeler(store), c)
+
+	fetch := func() []byte {
+		t.Helper()
+		rc, err := m.FetchLayer(ctx, layerDesc)
+		if err != nil {
+			t.Fatalf("FetchLayer() error = %v", err)
+		}
+		defer rc.Close()
+		got, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatalf("reading layer: %v", err)
+		}
+		return got
+	}
+
+	assert.Equal(t, layer, fetch())
+
+	// a corrupt cached layer is fetched from the remote again
+	name := filepath.Join(dir, "blobs", layerDesc.Digest.Algorithm().String(), layerDesc.Digest.Encoded())
+	if err := os.WriteFile(name, []byte("JUNK"), 0o644); err != nil {
+		t.Fatalf("corrupting cached layer: %v", err)
+	}
+	assert.Equal(t, layer, fetch())
+
+	rc, err := c.Open(layerDesc.Digest)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	rc.Close()
+}
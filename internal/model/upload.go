@@ -0,0 +1,366 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/registry/remote"
+	"oras.land/oras-go/v2/registry/remote/auth"
+
+	"github.com/act3-ai/gitoci/pkg/oci"
+)
+
+// streamChunkSize is the size of the chunks uploaded by PushLayerStream,
+// which buffers at most one chunk in memory.
+var streamChunkSize int64 = 16 << 20
+
+// PushLayerStream pushes a packfile layer blob read from r, without knowing
+// its size or digest in advance, returning its descriptor. See AddLayers to
+// include it in the manifest.
+//
+// Registries require the size of each request, so layers that fit in a chunk
+// are uploaded in one sized request and larger layers in sized chunks, see
+// PushLayerChunked. Other targets, e.g. OCI layouts, require the digest of
+// the layer before it is pushed, so it is written to a temporary file first.
+func (m *model) PushLayerStream(ctx context.Context, r io.Reader) (ocispec.Descriptor, error) {
+	repo, ok := m.target.(*remote.Repository)
+	if !ok {
+		return m.spoolLayer(ctx, r)
+	}
+
+	head := make([]byte, streamChunkSize)
+	n, err := io.ReadFull(r, head)
+	switch {
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		desc := content.NewDescriptorFromBytes(oci.MediaTypePackLayer, head[:n])
+		if err := m.PushLayer(ctx, desc, bytes.NewReader(head[:n])); err != nil {
+			return ocispec.Descriptor{}, err
+		}
+		return desc, nil
+	case err != nil:
+		return ocispec.Descriptor{}, fmt.Errorf("reading packfile layer: %w", err)
+	}
+
+	r = io.MultiReader(bytes.NewReader(head), r)
+	return pushChunks(ctx, repo, r, ChunkedUpload{ChunkSize: streamChunkSize})
+}
+
+// spoolLayer pushes a packfile layer blob read from r to a target without
+// upload sessions, writing it to a temporary file to learn its digest.
+func (m *model) spoolLayer(ctx context.Context, r io.Reader) (ocispec.Descriptor, error) {
+	f, err := os.CreateTemp("", "git-remote-oci-layer-*")
+	if err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("creating temporary layer file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	digester := digest.Canonical.Digester()
+	n, err := io.Copy(io.MultiWriter(f, digester.Hash()), r)
+	if err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("reading packfile layer: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("rewinding temporary layer file: %w", err)
+	}
+
+	desc := ocispec.Descriptor{
+		MediaType: oci.MediaTypePackLayer,
+		Digest:    digester.Digest(),
+		Size:      n,
+	}
+	if err := m.PushLayer(ctx, desc, f); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	return desc, nil
+}
+
+// UploadSession is the state of a chunked layer upload, from which an
+// interrupted upload can be resumed.
+type UploadSession struct {
+	// Location is the URL of the upload session
+	Location string `json:"location"`
+
+	// Offset is the number of bytes uploaded
+	Offset int64 `json:"offset"`
+
+	// Digest is the digest of the bytes uploaded, to check that a resumed
+	// layer starts with them
+	Digest digest.Digest `json:"digest"`
+}
+
+// ChunkedUpload configures a chunked layer upload, see PushLayerChunked.
+type ChunkedUpload struct {
+	// ChunkSize is the number of bytes uploaded per request
+	ChunkSize int64
+
+	// Resume is the session of an interrupted upload of the same layer, nil
+	// to start a new upload
+	Resume *UploadSession
+
+	// Save records the session after each chunk is uploaded, nil if it isn't
+	// recorded
+	Save func(UploadSession)
+}
+
+// PushLayerChunked pushes a packfile layer blob as PushLayerStream does,
+// uploading it in chunks of opts.ChunkSize so an interrupted upload may be
+// resumed from the last chunk the registry received. The layer is read from
+// the start when resuming, skipping the bytes already uploaded, which must
+// match opts.Resume. ErrUploadChanged is returned if they don't, as r can't be
+// read again.
+func (m *model) PushLayerChunked(ctx context.Context, r io.Reader, opts ChunkedUpload) (ocispec.Descriptor, error) {
+	repo, ok := m.target.(*remote.Repository)
+	if !ok {
+		return m.spoolLayer(ctx, r)
+	}
+	if opts.ChunkSize <= 0 {
+		return ocispec.Descriptor{}, fmt.Errorf("invalid chunk size %d", opts.ChunkSize)
+	}
+	return pushChunks(ctx, repo, r, opts)
+}
+
+// pushChunks uploads a packfile layer blob to repo in chunks, see
+// PushLayerChunked.
+func pushChunks(ctx context.Context, repo *remote.Repository, r io.Reader, opts ChunkedUpload) (ocispec.Descriptor, error) {
+	digester := digest.Canonical.Digester()
+	var up *upload
+	var offset int64
+	if opts.Resume != nil {
+		var err error
+		up, offset, err = resumeChunks(ctx, repo, r, digester, *opts.Resume)
+		if err != nil {
+			return ocispec.Descriptor{}, err
+		}
+	}
+	if up == nil {
+		var err error
+		up, err = startUpload(ctx, repo)
+		if err != nil {
+			return ocispec.Descriptor{}, err
+		}
+	}
+
+	buf := make([]byte, opts.ChunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if err := up.patch(buf[:n], offset); err != nil {
+				return ocispec.Descriptor{}, err
+			}
+			_, _ = digester.Hash().Write(buf[:n])
+			offset += int64(n)
+
+			if opts.Save != nil {
+				opts.Save(UploadSession{Location: up.location.String(), Offset: offset, Digest: digester.Digest()})
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return ocispec.Descriptor{}, fmt.Errorf("reading packfile layer: %w", err)
+		}
+	}
+
+	desc := ocispec.Descriptor{
+		MediaType: oci.MediaTypePackLayer,
+		Digest:    digester.Digest(),
+		Size:      offset,
+	}
+	if err := up.complete(desc.Digest); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	return desc, nil
+}
+
+// resumeChunks resumes an interrupted chunked upload, skipping the bytes of r
+// the registry has received. A nil upload is returned if the session can't be
+// resumed, e.g. it expired, and nothing was read from r.
+func resumeChunks(ctx context.Context, repo *remote.Repository, r io.Reader, digester digest.Digester, session UploadSession) (*upload, int64, error) {
+	up, err := resumeUpload(ctx, repo, session.Location)
+	if err != nil {
+		slog.DebugContext(ctx, "restarting layer upload", "reason", err)
+		return nil, 0, nil
+	}
+	received, err := up.offset()
+	switch {
+	case err != nil:
+		slog.DebugContext(ctx, "restarting layer upload", "reason", err)
+		return nil, 0, nil
+	case received < session.Offset:
+		slog.DebugContext(ctx, "restarting layer upload", "reason", "registry lost uploaded chunks", "received", received, "uploaded", session.Offset)
+		return nil, 0, nil
+	}
+
+	if err := skipUploaded(r, digester, session.Offset); err != nil {
+		return nil, 0, err
+	}
+	if digester.Digest() != session.Digest {
+		return nil, 0, ErrUploadChanged
+	}
+
+	// chunks interrupted after the session was saved may have been received
+	if err := skipUploaded(r, digester, received-session.Offset); err != nil {
+		return nil, 0, err
+	}
+	slog.InfoContext(ctx, "resuming layer upload", "offset", received)
+	return up, received, nil
+}
+
+// skipUploaded reads n bytes of r that were already uploaded into digester.
+func skipUploaded(r io.Reader, digester digest.Digester, n int64) error {
+	_, err := io.CopyN(digester.Hash(), r, n)
+	switch {
+	case errors.Is(err, io.EOF):
+		// the layer is shorter than the bytes uploaded
+		return ErrUploadChanged
+	case err != nil:
+		return fmt.Errorf("reading packfile layer: %w", err)
+	}
+	return nil
+}
+
+// upload is a blob upload session of a registry.
+//
+// https://github.com/opencontainers/distribution-spec/blob/main/spec.md#pushing-a-blob-in-chunks
+type upload struct {
+	ctx    context.Context
+	client remote.Client
+
+	// location is the URL of the session, which changes with each request
+	location *url.URL
+}
+
+// startUpload starts a blob upload session in repo.
+func startUpload(ctx context.Context, repo *remote.Repository) (*upload, error) {
+	scheme := "https"
+	if repo.PlainHTTP {
+		scheme = "http"
+	}
+	start := &url.URL{
+		Scheme: scheme,
+		Host:   repo.Reference.Host(),
+		Path:   fmt.Sprintf("/v2/%s/blobs/uploads/", repo.Reference.Repository),
+	}
+
+	up := newUpload(ctx, repo, start)
+	if _, err := up.do(http.MethodPost, nil, nil, http.StatusAccepted); err != nil {
+		return nil, fmt.Errorf("starting layer upload: %w", err)
+	}
+	return up, nil
+}
+
+// resumeUpload resumes the blob upload session of repo at location.
+func resumeUpload(ctx context.Context, repo *remote.Repository, location string) (*upload, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("parsing upload location: %w", err)
+	}
+	return newUpload(ctx, repo, u), nil
+}
+
+// newUpload returns the blob upload session of repo at location.
+func newUpload(ctx context.Context, repo *remote.Repository, location *url.URL) *upload {
+	client := repo.Client
+	if client == nil {
+		client = auth.DefaultClient
+	}
+	ctx = auth.AppendRepositoryScope(ctx, repo.Reference, auth.ActionPull, auth.ActionPush)
+	return &upload{ctx: ctx, client: client, location: location}
+}
+
+// offset returns the number of bytes the registry has received.
+func (up *upload) offset() (int64, error) {
+	header, err := up.do(http.MethodGet, nil, nil, http.StatusNoContent)
+	if err != nil {
+		return 0, fmt.Errorf("checking layer upload: %w", err)
+	}
+
+	// the range of bytes received is inclusive, 0-0 or 0--1 if none were
+	var start, end int64
+	if _, err := fmt.Sscanf(header.Get("Range"), "%d-%d", &start, &end); err != nil {
+		return 0, fmt.Errorf("checking layer upload: invalid range %q: %w", header.Get("Range"), err)
+	}
+	if end <= 0 {
+		return 0, nil
+	}
+	return end + 1, nil
+}
+
+// patch uploads a chunk of the blob starting at offset, sized so registries
+// can verify it.
+func (up *upload) patch(chunk []byte, offset int64) error {
+	header := http.Header{
+		"Content-Type":  []string{"application/octet-stream"},
+		"Content-Range": []string{fmt.Sprintf("%d-%d", offset, offset+int64(len(chunk))-1)},
+	}
+	// the request's ContentLength is set from the bytes.Reader
+	if _, err := up.do(http.MethodPatch, header, bytes.NewReader(chunk), http.StatusAccepted); err != nil {
+		return fmt.Errorf("uploading layer: %w", err)
+	}
+	return nil
+}
+
+// complete completes the upload of a blob with its digest.
+func (up *upload) complete(dgst digest.Digest) error {
+	u := *up.location
+	q := u.Query()
+	q.Set("digest", dgst.String())
+	u.RawQuery = q.Encode()
+	up.location = &u
+
+	if _, err := up.do(http.MethodPut, nil, nil, http.StatusCreated); err != nil {
+		return fmt.Errorf("completing layer upload: %w", err)
+	}
+	return nil
+}
+
+// do sends a request to the upload session, following its new location, and
+// returns the headers of the response.
+func (up *upload) do(method string, header http.Header, body io.Reader, want int) (http.Header, error) {
+	req, err := http.NewRequestWithContext(up.ctx, method, up.location.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := up.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", method, redactURL(up.location), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != want {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("%s %s: unexpected status %s: %s", method, redactURL(up.location), resp.Status, bytes.TrimSpace(msg))
+	}
+
+	if loc := resp.Header.Get("Location"); loc != "" && method != http.MethodPut {
+		next, err := resp.Request.URL.Parse(loc)
+		if err != nil {
+			return nil, fmt.Errorf("parsing upload location %s: %w", loc, err)
+		}
+		up.location = next
+	}
+	return resp.Header, nil
+}
+
+// redactURL omits the query of an upload URL, which may hold session state.
+func redactURL(u *url.URL) string {
+	r := *u
+	r.RawQuery = ""
+	return r.String()
+}
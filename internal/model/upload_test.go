@@ -0,0 +1,257 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/content/memory"
+	"oras.land/oras-go/v2/registry/remote"
+
+	"github.com/act3-ai/gitoci/pkg/oci"
+)
+
+// uploadRegistry is a registry accepting blob uploads, see upload. It holds a
+// single upload session.
+type uploadRegistry struct {
+	blobs    map[digest.Digest][]byte
+	received bytes.Buffer
+
+	// patches counts PATCH requests, failPatch fails the PATCH with its count
+	patches   int
+	failPatch int
+
+	// monolithic counts blobs uploaded in a single PUT request
+	monolithic int
+}
+
+// ServeHTTP implements http.Handler.
+func (reg *uploadRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/v2/test/blobs/uploads/":
+		reg.received.Reset()
+		w.Header().Set("Location", "/upload/1")
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodGet && r.URL.Path == "/upload/1":
+		w.Header().Set("Location", "/upload/1?state=patched")
+		w.Header().Set("Range", fmt.Sprintf("0-%d", max(reg.received.Len()-1, 0)))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPatch && r.URL.Path == "/upload/1":
+		reg.patches++
+		if reg.patches == reg.failPatch {
+			// server errors would be retried
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// chunks must be sized, streamed uploads aren't part of the spec
+		var start, end int
+		if _, err := fmt.Sscanf(r.Header.Get("Content-Range"), "%d-%d", &start, &end); err != nil || start != reg.received.Len() {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		if r.ContentLength != int64(end-start+1) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if _, err := io.Copy(&reg.received, r.Body); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Location", "/upload/1?state=patched")
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodPut && r.URL.Path == "/upload/1":
+		// a monolithic upload sends the blob, a chunked upload follows the
+		// location of its last chunk
+		switch {
+		case r.ContentLength > 0:
+			reg.monolithic++
+			if _, err := io.Copy(&reg.received, r.Body); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		case r.ContentLength < 0, r.URL.Query().Get("state") != "patched":
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		dgst := digest.Digest(r.URL.Query().Get("digest"))
+		if digest.FromBytes(reg.received.Bytes()) != dgst {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("digest invalid"))
+			return
+		}
+		reg.blobs[dgst] = bytes.Clone(reg.received.Bytes())
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// newUploadRepository returns a repository of a registry accepting uploads.
+func newUploadRepository(t *testing.T, reg *uploadRegistry) *remote.Repository {
+	t.Helper()
+
+	srv := httptest.NewServer(reg)
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatalf("parsing server URL: %v", err)
+	}
+	repo, err := remote.NewRepository(u.Host + "/test")
+	if err != nil {
+		t.Fatalf("NewRepository() error = %v", err)
+	}
+	repo.PlainHTTP = true
+	return repo
+}
+
+func Test_model_PushLayerStream(t *testing.T) {
+	ctx := context.Background()
+	layer := []byte("PACK")
+	want := content.NewDescriptorFromBytes(oci.MediaTypePackLayer, layer)
+
+	reg := &uploadRegistry{blobs: make(map[digest.Digest][]byte)}
+	got, err := NewModeler(newUploadRepository(t, reg)).PushLayerStream(ctx, bytes.NewReader(layer))
+	if err != nil {
+		t.Fatalf("PushLayerStream() error = %v", err)
+	}
+	assert.Equal(t, want, got)
+	assert.Equal(t, layer, reg.blobs[want.Digest])
+	assert.Equal(t, 1, reg.monolithic)
+	assert.Zero(t, reg.patches)
+}
+
+func Test_model_PushLayerStream_chunked(t *testing.T) {
+	ctx := context.Background()
+	layer := []byte("PACK0123456789")
+	want := content.NewDescriptorFromBytes(oci.MediaTypePackLayer, layer)
+
+	// layers larger than a chunk are not buffered
+	prev := streamChunkSize
+	streamChunkSize = 4
+	t.Cleanup(func() { streamChunkSize = prev })
+
+	reg := &uploadRegistry{blobs: make(map[digest.Digest][]byte)}
+	got, err := NewModeler(newUploadRepository(t, reg)).PushLayerStream(ctx, bytes.NewReader(layer))
+	if err != nil {
+		t.Fatalf("PushLayerStream() error = %v", err)
+	}
+	assert.Equal(t, want, got)
+	assert.Equal(t, layer, reg.blobs[want.Digest])
+	assert.Zero(t, reg.monolithic)
+	assert.Equal(t, 4, reg.patches)
+}
+
+func Test_model_PushLayerStream_memory(t *testing.T) {
+	ctx := context.Background()
+	layer := []byte("PACK")
+	want := content.NewDescriptorFromBytes(oci.MediaTypePackLayer, layer)
+
+	store := memory.New()
+	got, err := NewModeler(store).PushLayerStream(ctx, bytes.NewReader(layer))
+	if err != nil {
+		t.Fatalf("PushLayerStream() error = %v", err)
+	}
+	assert.Equal(t, want, got)
+
+	rc, err := store.Fetch(ctx, want)
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("reading layer: %v", err)
+	}
+	assert.Equal(t, layer, b)
+}
+
+func Test_model_PushLayerChunked(t *testing.T) {
+	ctx := context.Background()
+	layer := []byte("PACK0123456789")
+	want := content.NewDescriptorFromBytes(oci.MediaTypePackLayer, layer)
+
+	// the upload fails on the third chunk
+	reg := &uploadRegistry{blobs: make(map[digest.Digest][]byte), failPatch: 3}
+	m := NewModeler(newUploadRepository(t, reg))
+
+	var saved *UploadSession
+	opts := ChunkedUpload{
+		ChunkSize: 4,
+		Save:      func(s UploadSession) { saved = &s },
+	}
+	if _, err := m.PushLayerChunked(ctx, bytes.NewReader(layer), opts); err == nil {
+		t.Fatalf("PushLayerChunked() expected error")
+	}
+	if saved == nil {
+		t.Fatalf("PushLayerChunked() saved no session")
+	}
+	assert.Equal(t, int64(8), saved.Offset)
+	assert.Equal(t, digest.FromBytes(layer[:8]), saved.Digest)
+
+	// resuming sends the remaining chunks
+	opts.Resume = saved
+	got, err := m.PushLayerChunked(ctx, bytes.NewReader(layer), opts)
+	if err != nil {
+		t.Fatalf("PushLayerChunked() error = %v", err)
+	}
+	assert.Equal(t, want, got)
+	assert.Equal(t, layer, reg.blobs[want.Digest])
+	assert.Equal(t, 5, reg.patches)
+}
+
+func Test_model_PushLayerChunked_resume(t *testing.T) {
+	ctx := context.Background()
+	layer := []byte("PACK0123456789")
+
+	tests := []struct {
+		name    string
+		session UploadSession
+		wantErr error
+	}{
+		{
+			name:    "Changed Layer",
+			session: UploadSession{Location: "/upload/1", Offset: 4, Digest: digest.FromString("JUNK")},
+			wantErr: ErrUploadChanged,
+		},
+		{
+			name:    "Shorter Layer",
+			session: UploadSession{Location: "/upload/1", Offset: 32, Digest: digest.FromString("JUNK")},
+			wantErr: ErrUploadChanged,
+		},
+		{
+			name:    "Expired Session",
+			session: UploadSession{Location: "/upload/expired", Offset: 4, Digest: digest.FromBytes(layer[:4])},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := &uploadRegistry{blobs: make(map[digest.Digest][]byte)}
+			repo := newUploadRepository(t, reg)
+
+			// the registry has received the chunks of the session
+			reg.received.Write(make([]byte, tt.session.Offset))
+			session := tt.session
+			session.Location = "http://" + repo.Reference.Host() + session.Location
+
+			opts := ChunkedUpload{ChunkSize: 4, Resume: &session}
+			got, err := NewModeler(repo).PushLayerChunked(ctx, bytes.NewReader(layer), opts)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				t.Fatalf("PushLayerChunked() error = %v", err)
+			}
+			assert.Equal(t, layer, reg.blobs[got.Digest])
+		})
+	}
+}
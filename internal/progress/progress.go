@@ -0,0 +1,156 @@
+// Package progress reports the progress of layer transfers in the style of Git.
+package progress
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// updateInterval limits how often progress is written.
+const updateInterval = 100 * time.Millisecond
+
+// now returns the current time, replaced in tests.
+var now = time.Now
+
+// Meter tracks the progress of a set of layer transfers, writing Git style
+// progress lines, e.g. "Receiving layers:  42% (3/7), 120.00 MiB | 15.00 MiB/s".
+//
+// A nil Meter is valid and reports nothing.
+type Meter struct {
+	mu sync.Mutex
+
+	w     io.Writer
+	title string
+	total int
+
+	done  int
+	bytes int64
+	start time.Time
+	last  time.Time
+}
+
+// NewMeter initializes a Meter for total layers, written to w.
+func NewMeter(w io.Writer, title string, total int) *Meter {
+	t := now()
+	return &Meter{
+		w:     w,
+		title: title,
+		total: total,
+		start: t,
+		last:  t,
+	}
+}
+
+// Reader wraps r, counting the bytes read towards the transfer progress.
+func (m *Meter) Reader(r io.Reader) io.Reader {
+	if m == nil {
+		return r
+	}
+	return &reader{r: r, m: m}
+}
+
+// Discard uncounts the bytes read through r, a Reader of m, e.g. before its
+// transfer is retried, so retried bytes are not counted twice.
+func (m *Meter) Discard(r io.Reader) {
+	cr, ok := r.(*reader)
+	if m == nil || !ok {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bytes -= cr.n
+	cr.n = 0
+}
+
+// LayerDone marks the transfer of a layer as complete.
+func (m *Meter) LayerDone() {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.done++
+	m.write(false)
+}
+
+// Finish writes the final progress line.
+func (m *Meter) Finish() {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.write(true)
+}
+
+// add counts n bytes transferred through r.
+func (m *Meter) add(r *reader, n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r.n += int64(n)
+	m.bytes += int64(n)
+	if now().Sub(m.last) >= updateInterval {
+		m.write(false)
+	}
+}
+
+// write writes a progress line, must be called with the lock held.
+func (m *Meter) write(final bool) {
+	t := now()
+	m.last = t
+
+	percent := 100
+	if m.total > 0 {
+		percent = m.done * 100 / m.total
+	}
+
+	var rate float64
+	if elapsed := t.Sub(m.start).Seconds(); elapsed > 0 {
+		rate = float64(m.bytes) / elapsed
+	}
+
+	line := fmt.Sprintf("%s: %3d%% (%d/%d), %s | %s/s", m.title, percent, m.done, m.total, HumanBytes(float64(m.bytes)), HumanBytes(rate))
+	if final {
+		_, _ = fmt.Fprintf(m.w, "\r%s, done.\n", line)
+		return
+	}
+	_, _ = fmt.Fprintf(m.w, "\r%s", line)
+}
+
+// HumanBytes formats a number of bytes with binary units, as Git does.
+func HumanBytes(n float64) string {
+	const unit = 1024
+	switch {
+	case n >= unit*unit*unit:
+		return fmt.Sprintf("%.2f GiB", n/(unit*unit*unit))
+	case n >= unit*unit:
+		return fmt.Sprintf("%.2f MiB", n/(unit*unit))
+	case n >= unit:
+		return fmt.Sprintf("%.2f KiB", n/unit)
+	default:
+		return fmt.Sprintf("%d bytes", int64(n))
+	}
+}
+
+// reader counts the bytes read from an io.Reader.
+type reader struct {
+	r io.Reader
+	m *Meter
+
+	// n is the number of bytes counted, guarded by the lock of m
+	n int64
+}
+
+// Read implements io.Reader.
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.m.add(r, n)
+	}
+	return n, err //nolint:wrapcheck
+}
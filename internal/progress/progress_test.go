@@ -0,0 +1,133 @@
+package progress
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const mib = 1 << 20
+
+// zeros is an endless stream of zero bytes.
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// setClock replaces the clock of the package, returning a function moving it
+// forward.
+func setClock(t *testing.T) func(d time.Duration) {
+	t.Helper()
+
+	clock := time.Date(2025, time.June, 15, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+	t.Cleanup(func() { now = time.Now })
+	return func(d time.Duration) { clock = clock.Add(d) }
+}
+
+// transfer reads n bytes through a Reader of m.
+func transfer(t *testing.T, m *Meter, n int64) io.Reader {
+	t.Helper()
+
+	r := m.Reader(zeros{})
+	if _, err := io.CopyN(io.Discard, r, n); err != nil {
+		t.Fatalf("reading: %v", err)
+	}
+	return r
+}
+
+// lastLine returns the last progress line written, Git overwrites each line
+// with the next.
+func lastLine(out string) string {
+	lines := strings.Split(out, "\r")
+	return lines[len(lines)-1]
+}
+
+func TestMeter(t *testing.T) {
+	advance := setClock(t)
+	var out bytes.Buffer
+	m := NewMeter(&out, "Receiving layers", 7)
+
+	advance(8 * time.Second)
+	transfer(t, m, 120*mib)
+	for range 3 {
+		m.LayerDone()
+	}
+	assert.Equal(t, "Receiving layers:  42% (3/7), 120.00 MiB | 15.00 MiB/s", lastLine(out.String()))
+
+	for range 4 {
+		m.LayerDone()
+	}
+	m.Finish()
+	assert.Equal(t, "Receiving layers: 100% (7/7), 120.00 MiB | 15.00 MiB/s, done.\n", lastLine(out.String()))
+}
+
+func TestMeter_throttled(t *testing.T) {
+	advance := setClock(t)
+	var out bytes.Buffer
+	m := NewMeter(&out, "Writing layers", 1)
+
+	// transfers write progress at most once per interval
+	transfer(t, m, mib)
+	assert.Empty(t, out.String())
+
+	// a single read, so the progress written includes all of it
+	advance(updateInterval)
+	if _, err := m.Reader(zeros{}).Read(make([]byte, mib)); err != nil {
+		t.Fatalf("reading: %v", err)
+	}
+	assert.Equal(t, "\rWriting layers:   0% (0/1), 2.00 MiB | 20.00 MiB/s", out.String())
+}
+
+func TestMeter_Discard(t *testing.T) {
+	advance := setClock(t)
+	var out bytes.Buffer
+	m := NewMeter(&out, "Writing layers", 2)
+
+	transfer(t, m, mib)
+	retried := transfer(t, m, 2*mib)
+	m.Discard(retried)
+	transfer(t, m, 2*mib)
+
+	advance(time.Second)
+	m.LayerDone()
+	assert.Equal(t, "Writing layers:  50% (1/2), 3.00 MiB | 3.00 MiB/s", lastLine(out.String()))
+
+	// discarding again has no effect
+	m.Discard(retried)
+	m.Finish()
+	assert.Equal(t, "Writing layers:  50% (1/2), 3.00 MiB | 3.00 MiB/s, done.\n", lastLine(out.String()))
+}
+
+func TestMeter_nil(t *testing.T) {
+	var m *Meter
+	r := transfer(t, m, mib)
+	m.Discard(r)
+	m.LayerDone()
+	m.Finish()
+}
+
+func TestHumanBytes(t *testing.T) {
+	tests := []struct {
+		n    float64
+		want string
+	}{
+		{n: 0, want: "0 bytes"},
+		{n: 1023, want: "1023 bytes"},
+		{n: 1024, want: "1.00 KiB"},
+		{n: 1536, want: "1.50 KiB"},
+		{n: 120 * mib, want: "120.00 MiB"},
+		{n: 3 << 30, want: "3.00 GiB"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, tt.want, HumanBytes(tt.n))
+		})
+	}
+}
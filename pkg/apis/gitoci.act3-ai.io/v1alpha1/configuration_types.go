@@ -5,7 +5,9 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 
+	"github.com/adrg/xdg"
 	"gopkg.in/yaml.v3"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
@@ -32,8 +34,60 @@ type ConfigurationSpec struct {
 
 	// Name is your name
 	Name string `json:"name"`
+
+	// Cache configures the local cache of packfile layers
+	Cache CacheConfig `json:"cache,omitempty"`
+
+	// Transfer configures the transfer of packfile layers
+	Transfer TransferConfig `json:"transfer,omitempty"`
+
+	// FastImport transfers objects with git fast-import and fast-export,
+	// offering the import and export capabilities to Git in place of connect,
+	// fetch and push
+	FastImport bool `json:"fastImport,omitempty"`
 }
 
+// TransferConfig configures the transfer of packfile layers to and from
+// registries.
+type TransferConfig struct {
+	// Concurrency is the number of layers uploaded or downloaded at once
+	Concurrency int `json:"concurrency,omitempty" yaml:"concurrency,omitempty"`
+
+	// ChunkThreshold is the size above which layers are uploaded in chunks,
+	// e.g. 32Mi, so interrupted uploads can resume
+	ChunkThreshold string `json:"chunkThreshold,omitempty" yaml:"chunkThreshold,omitempty"`
+
+	// ChunkSize is the size of each chunk of a chunked upload, e.g. 8Mi
+	ChunkSize string `json:"chunkSize,omitempty" yaml:"chunkSize,omitempty"`
+}
+
+// CacheConfig configures the local cache of packfile layers, keyed by digest
+// and shared by all repositories and remotes of a user.
+type CacheConfig struct {
+	// Disabled fetches every packfile layer from the registry
+	Disabled bool `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+
+	// Dir is the cache directory, defaults to git-remote-oci in the XDG cache directory
+	Dir string `json:"dir,omitempty" yaml:"dir,omitempty"`
+
+	// MaxSize limits the combined size of cached layers, e.g. 10Gi, evicting
+	// the least recently used layers first
+	MaxSize string `json:"maxSize,omitempty" yaml:"maxSize,omitempty"`
+}
+
+// Cache defaults.
+const (
+	defaultCacheDir     = "git-remote-oci"
+	defaultCacheMaxSize = "10Gi"
+)
+
+// Transfer defaults.
+const (
+	defaultConcurrency    = 4
+	defaultChunkThreshold = "32Mi"
+	defaultChunkSize      = "8Mi"
+)
+
 // Default the fields in Configuration.  The argument must be a Configuration
 func ConfigurationDefault(obj *Configuration) {
 	if obj == nil {
@@ -49,6 +103,21 @@ func ConfigurationDefault(obj *Configuration) {
 	if obj.Name == "" {
 		obj.Name = "None"
 	}
+	if obj.Cache.Dir == "" {
+		obj.Cache.Dir = filepath.Join(xdg.CacheHome, defaultCacheDir)
+	}
+	if obj.Cache.MaxSize == "" {
+		obj.Cache.MaxSize = defaultCacheMaxSize
+	}
+	if obj.Transfer.Concurrency == 0 {
+		obj.Transfer.Concurrency = defaultConcurrency
+	}
+	if obj.Transfer.ChunkThreshold == "" {
+		obj.Transfer.ChunkThreshold = defaultChunkThreshold
+	}
+	if obj.Transfer.ChunkSize == "" {
+		obj.Transfer.ChunkSize = defaultChunkSize
+	}
 }
 
 // MarshalLog implements the logr.Marshaller interface
@@ -130,6 +199,24 @@ func (c Configuration) ToDocumentedYAML(ctx context.Context) ([]byte, error) {
 	}
 	addField("exampleOption", "Example option", "", subNodes, false)
 
+	subNodes, err = apiutils.ToYamlNodes(c.Cache)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse configuration: %w", err)
+	}
+	addField("cache", "Local cache of packfile layers, shared by all repositories", "", subNodes, false)
+
+	subNodes, err = apiutils.ToYamlNodes(c.Transfer)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse configuration: %w", err)
+	}
+	addField("transfer", "Transfer of packfile layers to and from registries", "", subNodes, false)
+
+	subNodes, err = apiutils.ToYamlNodes(c.FastImport)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse configuration: %w", err)
+	}
+	addField("fastImport", "Transfer objects with git fast-import and fast-export", "", subNodes, false)
+
 	doc := &yaml.Node{
 		Kind:        yaml.DocumentNode,
 		HeadComment: commentConfigHead,
@@ -1,3 +1,4 @@
+// +groupName=gitoci.act3-ai.io
 // +kubebuilder:object:generate=true
 package v1alpha1
 
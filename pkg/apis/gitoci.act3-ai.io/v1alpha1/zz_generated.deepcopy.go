@@ -8,6 +8,21 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CacheConfig) DeepCopyInto(out *CacheConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CacheConfig.
+func (in *CacheConfig) DeepCopy() *CacheConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(CacheConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Configuration) DeepCopyInto(out *Configuration) {
 	*out = *in
@@ -47,3 +62,18 @@ func (in *ConfigurationSpec) DeepCopy() *ConfigurationSpec {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TransferConfig) DeepCopyInto(out *TransferConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TransferConfig.
+func (in *TransferConfig) DeepCopy() *TransferConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(TransferConfig)
+	in.DeepCopyInto(out)
+	return out
+}
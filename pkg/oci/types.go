@@ -4,6 +4,7 @@ import (
 	"github.com/opencontainers/go-digest"
 
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/config"
 )
 
 // Git OCI artifacts.
@@ -17,24 +18,81 @@ const (
 	// MediaTypePackLayer is the media type for a Git packfile stored as an OCI layer.
 	MediaTypePackLayer = "application/vnd.act3-ai.git.pack.v1"
 
+	// ArtifactTypePushCert is the artifact type for a Git push certificate,
+	// referring to the Git manifest resulting from the signed push.
+	ArtifactTypePushCert = "application/vnd.act3-ai.git.pushcert.v1+json"
+
+	// MediaTypePushCert is the media type for a Git push certificate, as
+	// signed by the pusher, stored as an OCI layer.
+	MediaTypePushCert = "application/vnd.act3-ai.git.pushcert.v1"
+
+	// AnnotationGitPackTips is the key for the packfile layer annotation listing the
+	// comma-separated object IDs of the references the packfile was created for.
+	AnnotationGitPackTips = "vnd.act3-ai.git.pack.tips"
+
+	// AnnotationGitCompactedFrom is the key for the manifest annotation recording
+	// the digest of the manifest a compaction replaced.
+	AnnotationGitCompactedFrom = "vnd.act3-ai.git.compacted-from"
+
+	// AnnotationGitCollectedFrom is the key for the manifest annotation recording
+	// the digest of the manifest a garbage collection replaced.
+	AnnotationGitCollectedFrom = "vnd.act3-ai.git.collected-from"
+
 	// AnnotationGitRemoteOCIVersion is the key for the annotation to denote the git-remote-oci version used during the most recent operation.
 	AnnotationGitRemoteOCIVersion = "vnd.act3-ai.git-remote-oci.version"
 )
 
 // ConfigGit is an OCI manifest config, containing information about a Git repository's references.
 type ConfigGit struct {
+	// ObjectFormat is the hash algorithm of the repository's object IDs, sha1
+	// or sha256. Configs without an object format are sha1.
+	ObjectFormat config.ObjectFormat `json:"objectFormat,omitempty"`
+
+	// Head is the branch the remote HEAD symbolic reference points to. Configs
+	// without a head advertise a default branch.
+	Head plumbing.ReferenceName `json:"head,omitempty"`
+
 	// Heads map Git head references to commit OID and layer digest pairs.
 	Heads map[plumbing.ReferenceName]ReferenceInfo `json:"heads"`
 
 	// Tags map Git tag references to commit OID and layer digest pairs.
 	Tags map[plumbing.ReferenceName]ReferenceInfo `json:"tags"`
+
+	// Refs map all other Git references, e.g. notes and replace references,
+	// to object OID and layer digest pairs.
+	Refs map[plumbing.ReferenceName]ReferenceInfo `json:"refs,omitempty"`
+}
+
+// References returns the reference maps of the config, heads, tags, and all
+// other references, in that order.
+func (c ConfigGit) References() []map[plumbing.ReferenceName]ReferenceInfo {
+	return []map[plumbing.ReferenceName]ReferenceInfo{c.Heads, c.Tags, c.Refs}
+}
+
+// Reference returns the information of a reference, if it exists.
+func (c ConfigGit) Reference(name plumbing.ReferenceName) (ReferenceInfo, bool) {
+	var info ReferenceInfo
+	var ok bool
+	switch {
+	case name.IsBranch():
+		info, ok = c.Heads[name]
+	case name.IsTag():
+		info, ok = c.Tags[name]
+	default:
+		info, ok = c.Refs[name]
+	}
+	return info, ok
 }
 
 // ReferenceInfo holds informations about Git references stored in bundle layers.
 type ReferenceInfo struct {
-	// Commit pointed to by a reference
+	// Commit pointed to by a reference, or the tag object of an annotated tag
 	Commit plumbing.Hash `json:"commit"`
 
+	// Peeled is the object an annotated tag ultimately refers to, usually a
+	// commit. Omitted for references pointing directly to a commit.
+	Peeled plumbing.Hash `json:"peeled,omitzero"`
+
 	// OCI layer, the packfile containing Commit
 	Layer digest.Digest `json:"layer"`
 }